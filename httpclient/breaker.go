@@ -0,0 +1,268 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("httpclient: circuit open")
+
+// CircuitOpenError is returned without sending the request while the breaker
+// of Host is open. It matches ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	Host  string
+	State BreakerState
+}
+
+func (self *CircuitOpenError) Error() string {
+	return fmt.Sprintf("httpclient: circuit %s for %s", self.State, self.Host)
+}
+
+func (self *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (self BreakerState) String() string {
+	switch self {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(self))
+}
+
+// BreakerConfig configures the per host circuit breaker. A closed breaker
+// opens once, within Window, at least MinRequests were sent and FailureRatio
+// of them failed. After OpenTimeout it lets HalfOpenRequests probes through
+// and closes when all of them succeed, or opens again on the first failure.
+type BreakerConfig struct {
+	FailureRatio     float64
+	MinRequests      int
+	Window           time.Duration
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+
+	// IsFailure defaults to a network error or a 5xx response. A cancelled
+	// context is never a failure of the upstream.
+	IsFailure func(res *http.Response, err error) bool
+
+	// OnStateChange is called on every transition, outside the breaker lock.
+	OnStateChange func(host string, from, to BreakerState)
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	FailureRatio:     0.5,
+	MinRequests:      20,
+	Window:           10 * time.Second,
+	OpenTimeout:      30 * time.Second,
+	HalfOpenRequests: 1,
+}
+
+// SetCircuitBreaker turns on a circuit breaker per upstream host, nil turns
+// it off. Breakers start closed and are created on first use.
+func (self *HttpClient) SetCircuitBreaker(config *BreakerConfig) {
+	if config == nil {
+		self.breakers = nil
+		return
+	}
+	self.breakers = &breakerGroup{config: *config, breakers: make(map[string]*breaker)}
+}
+
+// BreakerState returns the state of the breaker of host, closed if there is
+// none.
+func (self *HttpClient) BreakerState(host string) BreakerState {
+	if self.breakers == nil {
+		return StateClosed
+	}
+	b := self.breakers.lookup(host)
+	if b == nil {
+		return StateClosed
+	}
+	return b.currentState()
+}
+
+type breakerGroup struct {
+	config   BreakerConfig
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// lookup returns the breaker of host, nil if no request went there yet.
+func (self *breakerGroup) lookup(host string) *breaker {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.breakers[host]
+}
+
+func (self *breakerGroup) get(host string) *breaker {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	b, ok := self.breakers[host]
+	if !ok {
+		b = &breaker{host: host, config: &self.config}
+		self.breakers[host] = b
+	}
+	return b
+}
+
+func (self *breakerGroup) isFailure(res *http.Response, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if self.config.IsFailure != nil {
+		return self.config.IsFailure(res, err)
+	}
+	return err != nil || res.StatusCode >= http.StatusInternalServerError
+}
+
+type breaker struct {
+	host   string
+	config *BreakerConfig
+
+	mu         sync.Mutex
+	state      BreakerState
+	generation uint64    // bumped on every transition and window, stale results are dropped
+	expiry     time.Time // end of the window when closed, of the timeout when open
+	requests   int       // sent in the window, or probes sent when half-open
+	failures   int
+	successes  int
+}
+
+func (self *breaker) currentState() BreakerState {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.state
+}
+
+// allow reports whether a request may be sent and the generation to report
+// its result under.
+func (self *breaker) allow() (uint64, error) {
+	self.mu.Lock()
+	now := time.Now()
+	from := self.state
+
+	switch self.state {
+	case StateClosed:
+		if self.config.Window > 0 && now.After(self.expiry) {
+			// a new window, results of requests sent in the last one are dropped
+			self.generation++
+			self.requests, self.failures, self.successes = 0, 0, 0
+			self.expiry = now.Add(self.config.Window)
+		}
+	case StateOpen:
+		if now.Before(self.expiry) {
+			self.mu.Unlock()
+			return 0, &CircuitOpenError{Host: self.host, State: StateOpen}
+		}
+		self.setState(StateHalfOpen, now)
+	}
+
+	if self.state == StateHalfOpen {
+		limit := self.config.HalfOpenRequests
+		if limit <= 0 {
+			limit = 1
+		}
+		if self.requests >= limit {
+			self.mu.Unlock()
+			self.notify(from, StateHalfOpen)
+			return 0, &CircuitOpenError{Host: self.host, State: StateHalfOpen}
+		}
+	}
+	self.requests++
+	generation, to := self.generation, self.state
+	self.mu.Unlock()
+
+	self.notify(from, to)
+	return generation, nil
+}
+
+func (self *breaker) done(generation uint64, failure bool) {
+	self.mu.Lock()
+	if generation != self.generation {
+		self.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	from := self.state
+
+	switch self.state {
+	case StateClosed:
+		if failure {
+			self.failures++
+		} else {
+			self.successes++
+		}
+		// the ratio is over completed requests, those in flight are unknown
+		completed := self.failures + self.successes
+		if completed >= self.config.MinRequests && float64(self.failures) >= self.config.FailureRatio*float64(completed) && self.failures > 0 {
+			self.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if failure {
+			self.setState(StateOpen, now)
+			break
+		}
+		self.successes++
+		if self.successes >= self.requests && self.successes >= self.config.HalfOpenRequests {
+			self.setState(StateClosed, now)
+		}
+	}
+	to := self.state
+	self.mu.Unlock()
+
+	self.notify(from, to)
+}
+
+func (self *breaker) setState(state BreakerState, now time.Time) {
+	self.state = state
+	self.generation++
+	self.requests, self.failures, self.successes = 0, 0, 0
+
+	switch state {
+	case StateClosed:
+		self.expiry = now.Add(self.config.Window)
+	case StateOpen:
+		self.expiry = now.Add(self.config.OpenTimeout)
+	default:
+		self.expiry = time.Time{}
+	}
+}
+
+func (self *breaker) notify(from, to BreakerState) {
+	if from != to && self.config.OnStateChange != nil {
+		self.config.OnStateChange(self.host, from, to)
+	}
+}
+
+// send makes one attempt through the breaker of the request's host.
+func (self *HttpClient) send(req *http.Request) (*http.Response, []byte, error) {
+	group := self.breakers
+	if group == nil {
+		return self.doOnce(req)
+	}
+
+	b := group.get(req.URL.Host)
+	generation, err := b.allow()
+	if err != nil {
+		return nil, nil, err
+	}
+	res, buf, err := self.doOnce(req)
+	b.done(generation, group.isFailure(res, err))
+	return res, buf, err
+}
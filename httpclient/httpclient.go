@@ -2,12 +2,12 @@ package httpclient
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"mime/multipart"
 	"net"
 	"net/http"
@@ -33,7 +33,11 @@ type Part struct {
 }
 
 type HttpClient struct {
-	cli *http.Client
+	cli          *http.Client
+	transport    http.RoundTripper
+	interceptors []Interceptor
+	retry        *RetryPolicy
+	breakers     *breakerGroup
 }
 
 func NewDefClient() *HttpClient {
@@ -53,10 +57,16 @@ func NewClient(timeout, dialTimeout, keepaliveTimeout, tlsHandshakeTimeout time.
 	}
 
 	cli := &http.Client{Transport: tr, Timeout: timeout}
-	return &HttpClient{cli}
+	client := &HttpClient{cli: cli, transport: tr}
+	client.Use(LoggingInterceptor(DefaultLogConfig))
+	return client
 }
 
 func (self *HttpClient) PostMultipart(url string, fields url.Values, files []*Part) (*http.Response, []byte, error) {
+	return self.PostMultipartCtx(context.Background(), url, fields, files)
+}
+
+func (self *HttpClient) PostMultipartCtx(ctx context.Context, url string, fields url.Values, files []*Part, opts ...RequestOption) (*http.Response, []byte, error) {
 	var buffer bytes.Buffer
 	writer := multipart.NewWriter(&buffer)
 
@@ -90,73 +100,58 @@ func (self *HttpClient) PostMultipart(url string, fields url.Values, files []*Pa
 		return nil, nil, err
 	}
 
-	header := make(http.Header)
-	header.Set("Content-Type", writer.FormDataContentType())
-
-	return self.Post(url, header, &buffer)
+	opts = append([]RequestOption{WithHeader("Content-Type", writer.FormDataContentType())}, opts...)
+	return self.PostCtx(ctx, url, &buffer, opts...)
 }
 
 func (self *HttpClient) PostJson(url string, data interface{}) (*http.Response, []byte, error) {
-	header := make(http.Header)
-	header.Set("Content-Type", "application/json")
+	return self.PostJsonCtx(context.Background(), url, data)
+}
 
+func (self *HttpClient) PostJsonCtx(ctx context.Context, url string, data interface{}, opts ...RequestOption) (*http.Response, []byte, error) {
 	var buff bytes.Buffer
 	encoder := json.NewEncoder(&buff)
 	encoder.SetEscapeHTML(false) // 必须设置为False， 不允许把字符转成\uxxxx表示
 	if err := encoder.Encode(data); err != nil {
 		panic(fmt.Errorf("[HTTP_RPC] marshal data for Postjson Error :%s", err.Error()))
 	}
-	if buff.Len() > 1000 {
-		v := buff.Bytes()
-		log.Printf("[HTTP_RPC] POST-JSON: %s ... %s [Data too long. length=%d]", v[:500], v[len(v)-500:], len(v))
-	} else {
-		log.Printf("[HTTP_RPC] POST-JSON: %s", buff.String())
-	}
-
-	return self.Post(url, header, &buff)
+	opts = append([]RequestOption{WithHeader("Content-Type", "application/json")}, opts...)
+	return self.PostCtx(ctx, url, &buff, opts...)
 }
 
 func (self *HttpClient) PutJson(url string, data interface{}) (*http.Response, []byte, error) {
-	header := make(http.Header)
-	header.Set("Content-Type", "application/json")
+	return self.PutJsonCtx(context.Background(), url, data)
+}
 
+func (self *HttpClient) PutJsonCtx(ctx context.Context, url string, data interface{}, opts ...RequestOption) (*http.Response, []byte, error) {
 	var buff bytes.Buffer
 	encoder := json.NewEncoder(&buff)
 	encoder.SetEscapeHTML(false) // 必须设置为False， 不允许把字符转成\uxxxx表示
 	if err := encoder.Encode(data); err != nil {
 		panic(fmt.Errorf("[HTTP_RPC] marshal data for PutJson Error :%s", err.Error()))
 	}
-	if buff.Len() > 1000 {
-		v := buff.Bytes()
-		log.Printf("[HTTP_RPC] PUT-JSON: %s ... %s [Data too long. length=%d]", v[:500], v[len(v)-500:], len(v))
-	} else {
-		log.Printf("[HTTP_RPC] PUT-JSON: %s", buff.String())
-	}
-	return self.Put(url, header, &buff)
+	opts = append([]RequestOption{WithHeader("Content-Type", "application/json")}, opts...)
+	return self.PutCtx(ctx, url, &buff, opts...)
 }
 
 func (self *HttpClient) PostForm(url string, data url.Values) (*http.Response, []byte, error) {
-	header := make(http.Header)
-	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return self.PostFormCtx(context.Background(), url, data)
+}
+
+func (self *HttpClient) PostFormCtx(ctx context.Context, url string, data url.Values, opts ...RequestOption) (*http.Response, []byte, error) {
 	v := data.Encode()
-	if len(v) > 1000 {
-		log.Printf("[HTTP_RPC] POST-FORM: %s ... %s [Data too long. length=%d]", v[:500], v[len(v)-500:], len(v))
-	} else {
-		log.Printf("[HTTP_RPC] POST-FORM: %s", v)
-	}
-	return self.Post(url, header, strings.NewReader(v))
+	opts = append([]RequestOption{WithHeader("Content-Type", "application/x-www-form-urlencoded")}, opts...)
+	return self.PostCtx(ctx, url, strings.NewReader(v), opts...)
 }
 
 func (self *HttpClient) PutForm(url string, data url.Values) (*http.Response, []byte, error) {
-	header := make(http.Header)
-	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return self.PutFormCtx(context.Background(), url, data)
+}
+
+func (self *HttpClient) PutFormCtx(ctx context.Context, url string, data url.Values, opts ...RequestOption) (*http.Response, []byte, error) {
 	v := data.Encode()
-	if len(v) > 1000 {
-		log.Printf("[HTTP_RPC] PUT-FORM: %s ... %s [Data too long. length=%d]", v[:500], v[len(v)-500:], len(v))
-	} else {
-		log.Printf("[HTTP_RPC] PUT-FORM: %s", v)
-	}
-	return self.Put(url, header, strings.NewReader(v))
+	opts = append([]RequestOption{WithHeader("Content-Type", "application/x-www-form-urlencoded")}, opts...)
+	return self.PutCtx(ctx, url, strings.NewReader(v), opts...)
 }
 
 func (self *HttpClient) Get(url string, header http.Header) (*http.Response, []byte, error) {
@@ -180,62 +175,23 @@ func (self *HttpClient) Request(method, url string, header http.Header, body io.
 }
 
 func (self *HttpClient) RequestWithCookie(method, url string, header http.Header, cookies []*http.Cookie, body io.Reader) (*http.Response, []byte, error) {
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	for _, cookie := range cookies {
-		req.AddCookie(cookie)
-	}
-
-	for k, v := range header {
-		if len(v) == 0 {
-			continue
-		}
-		if len(v) > 1 {
-			for _, h := range v {
-				req.Header.Add(k, h)
-			}
-		} else {
-			req.Header.Set(k, v[0])
-		}
-	}
-
-	return self.Do(req)
+	return self.RequestCtx(context.Background(), method, url, body, WithHeaders(header), WithCookies(cookies...))
 }
 
+// Do sends req, retrying it under the client's RetryPolicy and failing fast
+// with ErrCircuitOpen while the host's breaker is open, if either is set.
 func (self *HttpClient) Do(req *http.Request) (*http.Response, []byte, error) {
-	startTime := time.Now()
+	return self.doRetry(req, self.retry, false)
+}
+
+func (self *HttpClient) doOnce(req *http.Request) (*http.Response, []byte, error) {
 	res, err := self.cli.Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
-	var buf []byte
-	duration := time.Since(startTime)
-	defer func() {
-		tmp := strings.Split(req.URL.String(), "?")
-		logURL := tmp[0]
-		if res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusBadRequest {
-			// log.Printf("[HTTP_RPC] OK \"%s %s\" HEADER:[%v] - %d %.2fms",
-			//	req.Method, logURL, req.Header, res.StatusCode, float64(duration)/float64(time.Millisecond))
-		} else if res.StatusCode >= http.StatusInternalServerError {
-			log.Printf("[HTTP_RPC] SERVER ERROR \"%s %s\" HEADER:[%v] RESPONSE:[%s] - %d %.2fms",
-				req.Method, logURL, req.Header, buf, res.StatusCode, float64(duration)/float64(time.Millisecond))
-		} else {
-			log.Printf("[HTTP_RPC] FAIL \"%s %s\" HEADER:[%v] RESPONSE:[%s] - %d %.2fms",
-				req.Method, logURL, req.Header, buf, res.StatusCode, float64(duration)/float64(time.Millisecond))
-		}
-
-		if duration >= slowWarnTimeout {
-			log.Printf("[HTTP_RPC] [%s %s] too slow, use time: %d Sec", req.Method, logURL, duration/time.Second)
-		}
-		if res != nil {
-			res.Body.Close()
-		}
-	}()
+	defer res.Body.Close()
 
-	buf, err = ioutil.ReadAll(res.Body)
+	buf, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return nil, nil, err
 	}
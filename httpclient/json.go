@@ -0,0 +1,108 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrorBodyLimit is the number of body bytes kept in an HTTPError.
+var ErrorBodyLimit = 4096
+
+// HTTPError is returned by the JSON helpers for a non-2xx response.
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte // truncated to ErrorBodyLimit
+}
+
+func (self *HTTPError) Error() string {
+	return fmt.Sprintf("httpclient: %s %s: %s: %s", self.Method, self.URL, self.Status, self.Body)
+}
+
+// WithStrictJSON makes GetJSON and DoJSON reject response fields out does
+// not declare.
+func WithStrictJSON() RequestOption {
+	return func(opts *requestOptions) {
+		opts.strictJSON = true
+	}
+}
+
+// GetJSON gets url and decodes a 2xx body into out.
+func (self *HttpClient) GetJSON(ctx context.Context, url string, out interface{}, opts ...RequestOption) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	return self.DoJSON(ctx, req, nil, out, opts...)
+}
+
+// DoJSON sends req with in, unless nil, encoded as its JSON body and decodes a
+// 2xx response into out, unless nil or the body is empty. Other statuses come
+// back as *HTTPError.
+func (self *HttpClient) DoJSON(ctx context.Context, req *http.Request, in interface{}, out interface{}, opts ...RequestOption) error {
+	if in != nil {
+		var buff bytes.Buffer
+		encoder := json.NewEncoder(&buff)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(in); err != nil {
+			return err
+		}
+		data := buff.Bytes()
+
+		req = req.Clone(ctx)
+		req.ContentLength = int64(len(data))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		req.Body, _ = req.GetBody()
+		if len(req.Header.Get("Content-Type")) == 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if len(req.Header.Get("Accept")) == 0 {
+		opts = append([]RequestOption{WithHeader("Accept", "application/json")}, opts...)
+	}
+
+	res, buf, err := self.DoCtx(ctx, req, opts...)
+	if err != nil {
+		return err
+	}
+
+	if res.Request != nil {
+		// the request as sent, with the query options applied
+		req = res.Request
+	}
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		if len(buf) > ErrorBodyLimit {
+			buf = buf[:ErrorBodyLimit]
+		}
+		return &HTTPError{
+			Method:     req.Method,
+			URL:        req.URL.Redacted(),
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     res.Header,
+			Body:       buf,
+		}
+	}
+
+	if out == nil || len(bytes.TrimSpace(buf)) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	if newRequestOptions(opts).strictJSON {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("httpclient: decode %s %s: %w", req.Method, req.URL.Redacted(), err)
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RoundTripFunc adapts a function to http.RoundTripper.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (self RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return self(req)
+}
+
+// Interceptor wraps the next RoundTripper of the chain. Like any
+// RoundTripper it must not modify req; clone it to change headers.
+type Interceptor func(next http.RoundTripper) http.RoundTripper
+
+// Use appends interceptors to the chain, the first one being the outermost.
+// It is meant for setup, not for a client already serving requests.
+func (self *HttpClient) Use(interceptors ...Interceptor) {
+	self.SetInterceptors(append(self.interceptors[:len(self.interceptors):len(self.interceptors)], interceptors...)...)
+}
+
+// SetInterceptors replaces the whole chain, the default logging included.
+func (self *HttpClient) SetInterceptors(interceptors ...Interceptor) {
+	self.interceptors = interceptors
+	var rt http.RoundTripper = self.transport
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		rt = interceptors[i](rt)
+	}
+	self.cli.Transport = rt
+}
+
+// Logger is satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type LogConfig struct {
+	Logger        Logger        // defaults to the standard logger
+	Prefix        string        // e.g. [HTTP_RPC]
+	RequestBody   bool          // log json and form request bodies
+	Success       bool          // log 2xx and 3xx responses too
+	SlowThreshold time.Duration // warn about slower requests, 0 disables
+	MaxBody       int           // longer bodies are logged head and tail
+	RedactHeaders []string      // logged as ***, nil means DefaultRedactHeaders
+}
+
+// DefaultRedactHeaders are the credential headers kept out of the logs.
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Signature"}
+
+var DefaultLogConfig = LogConfig{
+	Prefix:        "[HTTP_RPC]",
+	RequestBody:   true,
+	SlowThreshold: slowWarnTimeout,
+	MaxBody:       1000,
+}
+
+// LoggingInterceptor logs request bodies, failed responses with their body
+// and slow requests. NewClient installs it with DefaultLogConfig.
+func LoggingInterceptor(config LogConfig) Interceptor {
+	printf := log.Printf
+	if config.Logger != nil {
+		printf = config.Logger.Printf
+	}
+	prefix := config.Prefix
+	if len(prefix) > 0 {
+		prefix += " "
+	}
+	redactHeaders := config.RedactHeaders
+	if redactHeaders == nil {
+		redactHeaders = DefaultRedactHeaders
+	}
+	redact := func(header http.Header) http.Header {
+		cloned := false
+		for _, k := range redactHeaders {
+			if _, ok := header[http.CanonicalHeaderKey(k)]; !ok {
+				continue
+			}
+			if !cloned {
+				header, cloned = header.Clone(), true
+			}
+			header.Set(k, "***")
+		}
+		return header
+	}
+	truncate := func(v []byte) string {
+		if config.MaxBody > 0 && len(v) > config.MaxBody {
+			half := config.MaxBody / 2
+			return string(v[:half]) + " ... " + string(v[len(v)-half:]) + " [Data too long. length=" + strconv.Itoa(len(v)) + "]"
+		}
+		return string(v)
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if config.RequestBody && req.GetBody != nil {
+				contentType := req.Header.Get("Content-Type")
+				kind := ""
+				if strings.HasPrefix(contentType, "application/json") {
+					kind = "JSON"
+				} else if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+					kind = "FORM"
+				}
+				if len(kind) > 0 {
+					if body, err := req.GetBody(); err == nil {
+						data, _ := io.ReadAll(body)
+						body.Close()
+						printf("%s%s-%s: %s", prefix, req.Method, kind, truncate(bytes.TrimSpace(data)))
+					}
+				}
+			}
+
+			startTime := time.Now()
+			res, err := next.RoundTrip(req)
+			duration := time.Since(startTime)
+			logURL := strings.Split(req.URL.String(), "?")[0]
+			header := redact(req.Header)
+			ms := float64(duration) / float64(time.Millisecond)
+
+			switch {
+			case err != nil:
+				printf("%sERROR \"%s %s\" HEADER:[%v] - %v %.2fms", prefix, req.Method, logURL, header, err, ms)
+			case res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusBadRequest:
+				if config.Success {
+					printf("%sOK \"%s %s\" HEADER:[%v] - %d %.2fms", prefix, req.Method, logURL, header, res.StatusCode, ms)
+				}
+			default:
+				// peek at the body for the log and hand it on unread
+				limit := int64(config.MaxBody)
+				if limit <= 0 {
+					limit = 1000
+				}
+				head, _ := io.ReadAll(io.LimitReader(res.Body, limit))
+				res.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(head), res.Body), res.Body}
+
+				status := "FAIL"
+				if res.StatusCode >= http.StatusInternalServerError {
+					status = "SERVER ERROR"
+				}
+				printf("%s%s \"%s %s\" HEADER:[%v] RESPONSE:[%s] - %d %.2fms", prefix, status, req.Method, logURL, header, head, res.StatusCode, ms)
+			}
+
+			if config.SlowThreshold > 0 && duration >= config.SlowThreshold {
+				printf("%s[%s %s] too slow, use time: %d Sec", prefix, req.Method, logURL, duration/time.Second)
+			}
+			return res, err
+		})
+	}
+}
+
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID stores the id of the inbound request for
+// RequestIDInterceptor to forward.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDInterceptor sets header, RequestIDHeader if empty, to the id in
+// the request context, or to a new random id. A header already set is kept.
+func RequestIDInterceptor(header string) Interceptor {
+	if len(header) == 0 {
+		header = RequestIDHeader
+	}
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if len(req.Header.Get(header)) > 0 {
+				return next.RoundTrip(req)
+			}
+
+			id := RequestIDFromContext(req.Context())
+			if len(id) == 0 {
+				id = newRequestID()
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set(header, id)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestMetrics describes one attempt. Duration runs until the response
+// headers arrive.
+type RequestMetrics struct {
+	Method     string
+	Host       string
+	Path       string
+	StatusCode int // 0 when Err is set
+	Duration   time.Duration
+	Err        error
+}
+
+// MetricsInterceptor reports every attempt to observe, e.g. to feed a
+// latency histogram labelled by host and status.
+func MetricsInterceptor(observe func(m *RequestMetrics)) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			startTime := time.Now()
+			res, err := next.RoundTrip(req)
+
+			m := &RequestMetrics{
+				Method:   req.Method,
+				Host:     req.URL.Host,
+				Path:     req.URL.Path,
+				Duration: time.Since(startTime),
+				Err:      err,
+			}
+			if res != nil {
+				m.StatusCode = res.StatusCode
+			}
+			observe(m)
+			return res, err
+		})
+	}
+}
+
+// SignInterceptor lets sign add authentication to a copy of every request;
+// an error from sign fails the request unsent.
+func SignInterceptor(sign func(req *http.Request) error) Interceptor {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			if err := sign(req); err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// HMACSigner signs with HMAC-SHA256 over
+// "METHOD\nREQUEST_URI\nTIMESTAMP\nhex(sha256(body))" and sets X-Key-Id,
+// X-Timestamp and X-Signature. Use it with SignInterceptor.
+func HMACSigner(keyID string, secret []byte) func(req *http.Request) error {
+	return func(req *http.Request) error {
+		bodyHash := sha256.New()
+		if req.GetBody == nil && req.Body != nil && req.Body != http.NoBody {
+			return errors.New("httpclient: cannot sign a body without GetBody")
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(bodyHash, body)
+			body.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(req.Method + "\n" + req.URL.RequestURI() + "\n" + timestamp + "\n" + hex.EncodeToString(bodyHash.Sum(nil))))
+
+		req.Header.Set("X-Key-Id", keyID)
+		req.Header.Set("X-Timestamp", timestamp)
+		req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+		return nil
+	}
+}
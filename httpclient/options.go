@@ -0,0 +1,176 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type requestOptions struct {
+	timeout time.Duration
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+
+	basicAuth bool
+	username  string
+	password  string
+	bearer    string
+
+	retry      *RetryPolicy
+	retrySet   bool
+	idempotent bool
+	strictJSON bool
+}
+
+// RequestOption customizes a single request made through the *Ctx methods.
+type RequestOption func(opts *requestOptions)
+
+// WithTimeout bounds the request, body read included, on top of the client
+// wide timeout.
+func WithTimeout(timeout time.Duration) RequestOption {
+	return func(opts *requestOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// WithHeader sets a header, replacing any value already on the request.
+func WithHeader(key, value string) RequestOption {
+	return func(opts *requestOptions) {
+		opts.header.Set(key, value)
+	}
+}
+
+// WithHeaders adds every value of header to the request.
+func WithHeaders(header http.Header) RequestOption {
+	return func(opts *requestOptions) {
+		for k, values := range header {
+			for _, v := range values {
+				opts.header.Add(k, v)
+			}
+		}
+	}
+}
+
+// WithQuery adds a query parameter to the request url.
+func WithQuery(key, value string) RequestOption {
+	return func(opts *requestOptions) {
+		opts.query.Add(key, value)
+	}
+}
+
+func WithQueryValues(values url.Values) RequestOption {
+	return func(opts *requestOptions) {
+		for k, vs := range values {
+			for _, v := range vs {
+				opts.query.Add(k, v)
+			}
+		}
+	}
+}
+
+func WithCookies(cookies ...*http.Cookie) RequestOption {
+	return func(opts *requestOptions) {
+		opts.cookies = append(opts.cookies, cookies...)
+	}
+}
+
+func WithBasicAuth(username, password string) RequestOption {
+	return func(opts *requestOptions) {
+		opts.basicAuth = true
+		opts.username = username
+		opts.password = password
+	}
+}
+
+// WithBearerToken sets "Authorization: Bearer <token>".
+func WithBearerToken(token string) RequestOption {
+	return func(opts *requestOptions) {
+		opts.bearer = token
+	}
+}
+
+func newRequestOptions(opts []RequestOption) *requestOptions {
+	options := &requestOptions{header: make(http.Header), query: make(url.Values)}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+func (self *requestOptions) apply(req *http.Request) {
+	for k, values := range self.header {
+		req.Header.Del(k)
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	if len(self.query) > 0 {
+		query := req.URL.Query()
+		for k, values := range self.query {
+			for _, v := range values {
+				query.Add(k, v)
+			}
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+
+	for _, cookie := range self.cookies {
+		req.AddCookie(cookie)
+	}
+
+	if self.basicAuth {
+		req.SetBasicAuth(self.username, self.password)
+	}
+	if len(self.bearer) > 0 {
+		req.Header.Set("Authorization", "Bearer "+self.bearer)
+	}
+}
+
+func (self *HttpClient) GetCtx(ctx context.Context, url string, opts ...RequestOption) (*http.Response, []byte, error) {
+	return self.RequestCtx(ctx, "GET", url, nil, opts...)
+}
+
+func (self *HttpClient) PostCtx(ctx context.Context, url string, body io.Reader, opts ...RequestOption) (*http.Response, []byte, error) {
+	return self.RequestCtx(ctx, "POST", url, body, opts...)
+}
+
+func (self *HttpClient) PutCtx(ctx context.Context, url string, body io.Reader, opts ...RequestOption) (*http.Response, []byte, error) {
+	return self.RequestCtx(ctx, "PUT", url, body, opts...)
+}
+
+func (self *HttpClient) DeleteCtx(ctx context.Context, url string, opts ...RequestOption) (*http.Response, []byte, error) {
+	return self.RequestCtx(ctx, "DELETE", url, nil, opts...)
+}
+
+func (self *HttpClient) RequestCtx(ctx context.Context, method, url string, body io.Reader, opts ...RequestOption) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return self.DoCtx(ctx, req, opts...)
+}
+
+// DoCtx sends req bound to ctx, so it is aborted when ctx is cancelled, e.g.
+// when the inbound request it serves goes away. req itself is not modified.
+func (self *HttpClient) DoCtx(ctx context.Context, req *http.Request, opts ...RequestOption) (*http.Response, []byte, error) {
+	options := newRequestOptions(opts)
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		// Do reads the whole body before returning, so cancelling here is safe
+		defer cancel()
+	}
+
+	req = req.Clone(ctx)
+	options.apply(req)
+
+	policy := self.retry
+	if options.retrySet {
+		policy = options.retry
+	}
+	return self.doRetry(req, policy, options.idempotent)
+}
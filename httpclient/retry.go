@@ -0,0 +1,205 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries failed attempts with exponential backoff and jitter.
+// Only idempotent requests are retried unless RetryNonIdempotent is set or
+// the request is sent WithIdempotent.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts in total, the first one included
+	RetryStatus []int         // status codes worth another attempt
+	MinBackoff  time.Duration // wait before the second attempt, doubled after each one
+	MaxBackoff  time.Duration // cap of the wait, Retry-After included
+
+	RetryNonIdempotent bool
+	RetryError         func(err error) bool // defaults to IsRetriableError
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	RetryStatus: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	MinBackoff:  100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+// SetRetryPolicy makes every request of the client retry under policy, nil
+// turns retries off.
+func (self *HttpClient) SetRetryPolicy(policy *RetryPolicy) {
+	self.retry = policy
+}
+
+// WithRetryPolicy overrides the client's retry policy for one request.
+func WithRetryPolicy(policy *RetryPolicy) RequestOption {
+	return func(opts *requestOptions) {
+		opts.retry = policy
+		opts.retrySet = true
+	}
+}
+
+// WithIdempotent marks a POST or PATCH as safe to retry.
+func WithIdempotent() RequestOption {
+	return func(opts *requestOptions) {
+		opts.idempotent = true
+	}
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	return ok
+}
+
+// IsRetriableError reports whether err is a transient network failure: a
+// timeout, a refused or reset connection, or a connection closed early.
+func IsRetriableError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (self *RetryPolicy) retryStatus(code int) bool {
+	for _, v := range self.RetryStatus {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *RetryPolicy) retryError(err error) bool {
+	if self.RetryError != nil {
+		return self.RetryError(err)
+	}
+	return IsRetriableError(err)
+}
+
+// backoff returns the wait before attempt n (1 based): an exponential step
+// with half of it jittered.
+func (self *RetryPolicy) backoff(n int) time.Duration {
+	d := self.MinBackoff
+	for i := 1; i < n; i++ {
+		// a MaxBackoff of 0 means no cap, still stop before overflowing
+		if (self.MaxBackoff > 0 && d >= self.MaxBackoff) || d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+	}
+	if self.MaxBackoff > 0 && d > self.MaxBackoff {
+		d = self.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses Retry-After in seconds or as an http date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if len(v) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// replayable makes the body of req readable once per attempt.
+func replayable(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil
+}
+
+func (self *HttpClient) doRetry(req *http.Request, policy *RetryPolicy, idempotent bool) (*http.Response, []byte, error) {
+	if policy == nil || policy.MaxAttempts <= 1 || !(idempotent || policy.RetryNonIdempotent || isIdempotent(req)) {
+		return self.send(req)
+	}
+	if err := replayable(req); err != nil {
+		return nil, nil, err
+	}
+
+	ctx := req.Context()
+	for n := 1; ; n++ {
+		attempt := req
+		if n > 1 {
+			attempt = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, nil, err
+				}
+				attempt.Body = body
+			}
+		}
+
+		res, buf, err := self.send(attempt)
+		if n >= policy.MaxAttempts {
+			return res, buf, err
+		}
+
+		wait := policy.backoff(n)
+		if err != nil {
+			if ctx.Err() != nil || !policy.retryError(err) {
+				return res, buf, err
+			}
+		} else if !policy.retryStatus(res.StatusCode) {
+			return res, buf, err
+		} else if d, ok := retryAfter(res); ok {
+			if policy.MaxBackoff > 0 && d > policy.MaxBackoff {
+				// the server asks for longer than we are willing to wait
+				return res, buf, err
+			}
+			wait = d
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if err == nil {
+				return res, buf, nil
+			}
+			return nil, nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,643 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder is a test server that keeps the last request it got.
+type recorder struct {
+	*httptest.Server
+	last *http.Request
+}
+
+func newRecorder(handler http.HandlerFunc) *recorder {
+	r := &recorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.last = req
+		if handler != nil {
+			handler(w, req)
+		}
+	}))
+	return r
+}
+
+// slowHandler answers after d unless the request goes away first.
+func slowHandler(d time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-time.After(d):
+		}
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	srv := newRecorder(slowHandler(5 * time.Second))
+	defer srv.Close()
+	cli := NewDefClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, _, err := cli.GetCtx(ctx, srv.URL); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("cancel did not abort the request")
+	}
+
+	if _, _, err := cli.GetCtx(context.Background(), srv.URL, WithTimeout(20*time.Millisecond)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRequestOptions(t *testing.T) {
+	srv := newRecorder(nil)
+	defer srv.Close()
+	cli := NewDefClient()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/path?a=1", nil)
+	req.Header.Set("X-Old", "old")
+	_, _, err := cli.DoCtx(context.Background(), req,
+		WithQuery("b", "2"),
+		WithHeader("X-Old", "new"),
+		WithHeaders(http.Header{"X-Multi": {"1", "2"}}),
+		WithCookies(&http.Cookie{Name: "sid", Value: "s1"}),
+		WithBasicAuth("user", "pass"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := srv.last
+	if got.URL.Query().Get("a") != "1" || got.URL.Query().Get("b") != "2" {
+		t.Errorf("unexpected query: %s", got.URL.RawQuery)
+	}
+	if got.Header.Get("X-Old") != "new" || len(got.Header["X-Multi"]) != 2 {
+		t.Errorf("unexpected header: %v", got.Header)
+	}
+	if cookie, err := got.Cookie("sid"); err != nil || cookie.Value != "s1" {
+		t.Errorf("unexpected cookie: %v %v", cookie, err)
+	}
+	if user, pass, ok := got.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("unexpected basic auth: %s %s %v", user, pass, ok)
+	}
+	if req.URL.RawQuery != "a=1" || req.Header.Get("X-Old") != "old" {
+		t.Errorf("DoCtx modified the caller's request: %s %v", req.URL.RawQuery, req.Header)
+	}
+
+	if _, _, err := cli.DeleteCtx(context.Background(), srv.URL, WithBearerToken("tok")); err != nil {
+		t.Fatal(err)
+	}
+	if srv.last.Method != "DELETE" || srv.last.Header.Get("Authorization") != "Bearer tok" {
+		t.Errorf("unexpected request: %s %v", srv.last.Method, srv.last.Header)
+	}
+}
+
+func TestRequestWithCookie(t *testing.T) {
+	srv := newRecorder(nil)
+	defer srv.Close()
+	cli := NewDefClient()
+
+	header := http.Header{"X-One": {"1"}, "X-Two": {"a", "b"}, "X-Empty": {}}
+	cookies := []*http.Cookie{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}}
+	if _, _, err := cli.RequestWithCookie("PUT", srv.URL, header, cookies, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got := srv.last
+	if got.Method != "PUT" || got.Header.Get("X-One") != "1" || len(got.Header["X-Two"]) != 2 {
+		t.Errorf("unexpected header: %s %v", got.Method, got.Header)
+	}
+	if _, ok := got.Header["X-Empty"]; ok {
+		t.Errorf("an empty header was sent: %v", got.Header)
+	}
+	if len(got.Cookies()) != 2 {
+		t.Errorf("unexpected cookies: %v", got.Cookies())
+	}
+	if len(header["X-Two"]) != 2 || len(header) != 3 {
+		t.Errorf("the caller's header was modified: %v", header)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{MinBackoff: 10 * time.Millisecond}
+	for n := 1; n <= 4; n++ {
+		step := 10 * time.Millisecond << (n - 1)
+		if d := policy.backoff(n); d < step/2 || d > step {
+			t.Errorf("backoff(%d) = %v, want within [%v, %v]", n, d, step/2, step)
+		}
+	}
+
+	policy.MaxBackoff = 15 * time.Millisecond
+	if d := policy.backoff(10); d < 7*time.Millisecond || d > 15*time.Millisecond {
+		t.Errorf("backoff(10) = %v, want capped at 15ms", d)
+	}
+}
+
+// flakyServer fails the first failures requests with status and records the
+// body of every request.
+func flakyServer(failures int, status int, retryAfter string) (*httptest.Server, *[]string) {
+	bodies := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(data))
+		if len(bodies) <= failures {
+			if len(retryAfter) > 0 {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	return srv, &bodies
+}
+
+func TestRetry(t *testing.T) {
+	policy := DefaultRetryPolicy
+	policy.MinBackoff = time.Millisecond
+	cli := NewDefClient()
+	cli.SetRetryPolicy(&policy)
+
+	srv, bodies := flakyServer(2, http.StatusServiceUnavailable, "")
+	res, buf, err := cli.Get(srv.URL, nil)
+	if err != nil || res.StatusCode != http.StatusOK || string(buf) != "ok" || len(*bodies) != 3 {
+		t.Fatalf("unexpected result: %v %v %s attempts=%d", err, res, buf, len(*bodies))
+	}
+	srv.Close()
+
+	srv, bodies = flakyServer(5, http.StatusBadGateway, "")
+	res, _, err = cli.Get(srv.URL, nil)
+	if err != nil || res.StatusCode != http.StatusBadGateway || len(*bodies) != policy.MaxAttempts {
+		t.Fatalf("unexpected result: %v %v attempts=%d", err, res, len(*bodies))
+	}
+	srv.Close()
+
+	// a POST is not retried unless asked for
+	srv, bodies = flakyServer(1, http.StatusServiceUnavailable, "")
+	res, _, err = cli.PostJson(srv.URL, map[string]int{"a": 1})
+	if err != nil || res.StatusCode != http.StatusServiceUnavailable || len(*bodies) != 1 {
+		t.Fatalf("unexpected result: %v %v attempts=%d", err, res, len(*bodies))
+	}
+	srv.Close()
+
+	// every attempt resends the whole body, even one without GetBody
+	srv, bodies = flakyServer(2, http.StatusServiceUnavailable, "")
+	body := io.MultiReader(strings.NewReader("pay"), strings.NewReader("load"))
+	res, _, err = cli.PostCtx(context.Background(), srv.URL, body, WithIdempotent())
+	if err != nil || res.StatusCode != http.StatusOK || strings.Join(*bodies, ",") != "payload,payload,payload" {
+		t.Fatalf("unexpected result: %v %v bodies=%q", err, res, *bodies)
+	}
+	srv.Close()
+
+	post := policy
+	post.RetryNonIdempotent = true
+	srv, bodies = flakyServer(1, http.StatusServiceUnavailable, "")
+	res, _, err = cli.PostFormCtx(context.Background(), srv.URL, url.Values{"a": {"1"}}, WithRetryPolicy(&post))
+	if err != nil || res.StatusCode != http.StatusOK || strings.Join(*bodies, ",") != "a=1,a=1" {
+		t.Fatalf("unexpected result: %v %v bodies=%q", err, res, *bodies)
+	}
+	srv.Close()
+}
+
+func TestRetryAfter(t *testing.T) {
+	policy := DefaultRetryPolicy
+	policy.MinBackoff = time.Millisecond
+	cli := NewDefClient()
+	cli.SetRetryPolicy(&policy)
+
+	srv, bodies := flakyServer(1, http.StatusTooManyRequests, "1")
+	defer srv.Close()
+	start := time.Now()
+	res, _, err := cli.Get(srv.URL, nil)
+	if err != nil || res.StatusCode != http.StatusOK || len(*bodies) != 2 || time.Since(start) < time.Second {
+		t.Fatalf("unexpected result: %v %v attempts=%d after %v", err, res, len(*bodies), time.Since(start))
+	}
+
+	// a Retry-After beyond MaxBackoff returns the response instead of waiting
+	policy.MaxBackoff = 100 * time.Millisecond
+	*bodies = (*bodies)[:0]
+	res, _, err = cli.Get(srv.URL, nil)
+	if err != nil || res.StatusCode != http.StatusTooManyRequests || len(*bodies) != 1 {
+		t.Fatalf("unexpected result: %v %v attempts=%d", err, res, len(*bodies))
+	}
+
+	if d, ok := retryAfter(&http.Response{Header: http.Header{"Retry-After": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}}); !ok || d < 59*time.Minute {
+		t.Errorf("unexpected http date Retry-After: %v %v", d, ok)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	fail := true
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		attempts++
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	transitions := make([]string, 0)
+	config := BreakerConfig{
+		FailureRatio:     0.5,
+		MinRequests:      4,
+		Window:           time.Minute,
+		OpenTimeout:      50 * time.Millisecond,
+		HalfOpenRequests: 1,
+		OnStateChange: func(h string, from, to BreakerState) {
+			if h != host {
+				t.Errorf("unexpected host %s", h)
+			}
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	}
+	cli := NewDefClient()
+	cli.SetCircuitBreaker(&config)
+
+	if cli.BreakerState("unknown:80") != StateClosed || len(cli.breakers.breakers) != 0 {
+		t.Fatal("BreakerState created a breaker")
+	}
+
+	// under MinRequests the breaker stays closed, at the ratio it opens
+	fail = false
+	cli.Get(srv.URL, nil)
+	cli.Get(srv.URL, nil)
+	fail = true
+	cli.Get(srv.URL, nil)
+	if cli.BreakerState(host) != StateClosed {
+		t.Fatal("opened below MinRequests")
+	}
+	cli.Get(srv.URL, nil)
+	if cli.BreakerState(host) != StateOpen || attempts != 4 {
+		t.Fatalf("expected open after 2 of 4 failures, got %s", cli.BreakerState(host))
+	}
+
+	_, _, err := cli.Get(srv.URL, nil)
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.Host != host || attempts != 4 {
+		t.Fatalf("expected a fail fast ErrCircuitOpen, got %v attempts=%d", err, attempts)
+	}
+
+	// after OpenTimeout one probe goes through, its failure reopens
+	time.Sleep(60 * time.Millisecond)
+	res, _, err := cli.Get(srv.URL, nil)
+	if err != nil || res.StatusCode != http.StatusInternalServerError || cli.BreakerState(host) != StateOpen {
+		t.Fatalf("unexpected probe: %v %v %s", err, res, cli.BreakerState(host))
+	}
+	if _, _, err := cli.Get(srv.URL, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen after a failed probe, got %v", err)
+	}
+
+	// a successful probe closes it
+	time.Sleep(60 * time.Millisecond)
+	fail = false
+	if _, _, err := cli.Get(srv.URL, nil); err != nil || cli.BreakerState(host) != StateClosed {
+		t.Fatalf("unexpected probe: %v %s", err, cli.BreakerState(host))
+	}
+
+	want := "closed->open,open->half-open,half-open->open,open->half-open,half-open->closed"
+	if strings.Join(transitions, ",") != want {
+		t.Fatalf("unexpected transitions: %v", transitions)
+	}
+}
+
+func TestCircuitBreakerHalfOpenLimit(t *testing.T) {
+	b := &breaker{host: "h", config: &BreakerConfig{MinRequests: 1, FailureRatio: 1, OpenTimeout: time.Millisecond, HalfOpenRequests: 2}}
+	generation, _ := b.allow()
+	b.done(generation, true)
+	if b.currentState() != StateOpen {
+		t.Fatalf("expected open, got %s", b.currentState())
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	first, err1 := b.allow()
+	second, err2 := b.allow()
+	if _, err := b.allow(); err1 != nil || err2 != nil || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected 2 probes then ErrCircuitOpen: %v %v %v", err1, err2, err)
+	}
+	b.done(first, false)
+	if b.currentState() != StateHalfOpen {
+		t.Fatalf("closed before every probe succeeded: %s", b.currentState())
+	}
+	b.done(second, false)
+	if b.currentState() != StateClosed {
+		t.Fatalf("expected closed, got %s", b.currentState())
+	}
+
+	// a result from before the transition is ignored
+	b.done(first, true)
+	if b.currentState() != StateClosed {
+		t.Fatalf("a stale result changed the state: %s", b.currentState())
+	}
+}
+
+// logLines is a Logger keeping what is logged.
+type logLines []string
+
+func (self *logLines) Printf(format string, v ...interface{}) {
+	*self = append(*self, fmt.Sprintf(format, v...))
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	srv := newRecorder(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, "upstream down")
+		}
+	})
+	defer srv.Close()
+
+	var lines logLines
+	config := DefaultLogConfig
+	config.Logger = &lines
+	config.Success = true
+	cli := NewDefClient()
+	cli.SetInterceptors(LoggingInterceptor(config))
+
+	cli.PostJsonCtx(context.Background(), srv.URL+"/ok?token=secret", map[string]int{"a": 1})
+	_, buf, _ := cli.Get(srv.URL+"/fail", nil)
+	if string(buf) != "upstream down" {
+		t.Fatalf("the logged body was not handed on: %q", buf)
+	}
+
+	if len(lines) != 3 {
+		t.Fatalf("unexpected log: %q", lines)
+	}
+	if lines[0] != `[HTTP_RPC] POST-JSON: {"a":1}` {
+		t.Fatalf("unexpected request log: %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `[HTTP_RPC] OK "POST `+srv.URL+`/ok" HEADER:[`) || !strings.Contains(lines[1], "] - 200 ") || strings.Contains(lines[1], "secret") {
+		t.Fatalf("unexpected response log: %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], `[HTTP_RPC] SERVER ERROR "GET `+srv.URL+`/fail" HEADER:[`) || !strings.Contains(lines[2], "RESPONSE:[upstream down] - 502 ") {
+		t.Fatalf("unexpected failure log: %q", lines[2])
+	}
+
+	// credentials never reach the log
+	lines = nil
+	cli.GetCtx(context.Background(), srv.URL+"/fail", WithBearerToken("t0ken"), WithCookies(&http.Cookie{Name: "sid", Value: "c00kie"}), WithHeader("X-Signature", "s1gn"))
+	if len(lines) != 1 || strings.Contains(lines[0], "t0ken") || strings.Contains(lines[0], "c00kie") || strings.Contains(lines[0], "s1gn") ||
+		!strings.Contains(lines[0], "Authorization:[***]") || !strings.Contains(lines[0], "Cookie:[***]") || !strings.Contains(lines[0], "X-Signature:[***]") {
+		t.Fatalf("unexpected redacted log: %q", lines)
+	}
+	if srv.last.Header.Get("Authorization") != "Bearer t0ken" {
+		t.Fatalf("redaction modified the request: %v", srv.last.Header)
+	}
+
+	lines = nil
+	redacted := config
+	redacted.RedactHeaders = []string{"x-api-key"}
+	cli.SetInterceptors(LoggingInterceptor(redacted))
+	cli.GetCtx(context.Background(), srv.URL+"/fail", WithHeader("X-Api-Key", "k3y"), WithBasicAuth("u", "p"))
+	if len(lines) != 1 || strings.Contains(lines[0], "k3y") || !strings.Contains(lines[0], "Authorization:[Basic ") {
+		t.Fatalf("unexpected redacted log: %q", lines)
+	}
+
+	// long bodies are logged head and tail
+	lines = nil
+	config.MaxBody = 10
+	cli.SetInterceptors(LoggingInterceptor(config))
+	cli.PostFormCtx(context.Background(), srv.URL+"/ok", url.Values{"k": {strings.Repeat("v", 20)}})
+	if lines[0] != "[HTTP_RPC] POST-FORM: k=vvv ... vvvvv [Data too long. length=22]" {
+		t.Fatalf("unexpected truncated log: %q", lines[0])
+	}
+
+	// the default chain logs through the standard logger, no chain logs nothing
+	var std bytes.Buffer
+	log.SetOutput(&std)
+	defer log.SetOutput(os.Stderr)
+	cli = NewDefClient()
+	cli.Get(srv.URL+"/fail", nil)
+	if !strings.Contains(std.String(), "[HTTP_RPC] SERVER ERROR") {
+		t.Fatalf("expected the default logging, got %q", std.String())
+	}
+	std.Reset()
+	cli.SetInterceptors()
+	cli.Get(srv.URL+"/fail", nil)
+	cli.PostJson(srv.URL+"/ok", 1)
+	if std.Len() > 0 {
+		t.Fatalf("expected no logging, got %q", std.String())
+	}
+}
+
+func TestRequestIDInterceptor(t *testing.T) {
+	srv := newRecorder(nil)
+	defer srv.Close()
+	cli := NewDefClient()
+	cli.SetInterceptors(RequestIDInterceptor(""))
+
+	ctx := ContextWithRequestID(context.Background(), "inbound-id")
+	cli.GetCtx(ctx, srv.URL)
+	if id := srv.last.Header.Get(RequestIDHeader); id != "inbound-id" {
+		t.Fatalf("expected the context id, got %q", id)
+	}
+
+	cli.GetCtx(ctx, srv.URL, WithHeader(RequestIDHeader, "explicit-id"))
+	if id := srv.last.Header.Get(RequestIDHeader); id != "explicit-id" {
+		t.Fatalf("expected the header to be kept, got %q", id)
+	}
+
+	cli.GetCtx(context.Background(), srv.URL)
+	first := srv.last.Header.Get(RequestIDHeader)
+	cli.GetCtx(context.Background(), srv.URL)
+	second := srv.last.Header.Get(RequestIDHeader)
+	if len(first) != 32 || first == second {
+		t.Fatalf("expected new random ids, got %q and %q", first, second)
+	}
+
+	cli.SetInterceptors(RequestIDInterceptor("X-Trace-Id"))
+	cli.GetCtx(ctx, srv.URL)
+	if srv.last.Header.Get("X-Trace-Id") != "inbound-id" || len(srv.last.Header.Get(RequestIDHeader)) > 0 {
+		t.Fatalf("expected the custom header only, got %v", srv.last.Header)
+	}
+}
+
+func TestMetricsInterceptor(t *testing.T) {
+	srv, _ := flakyServer(1, http.StatusServiceUnavailable, "")
+	defer srv.Close()
+
+	var metrics []RequestMetrics
+	cli := NewDefClient()
+	cli.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, RetryStatus: []int{http.StatusServiceUnavailable}})
+	cli.SetInterceptors(MetricsInterceptor(func(m *RequestMetrics) {
+		metrics = append(metrics, *m)
+	}))
+
+	if _, _, err := cli.Get(srv.URL+"/path?q=1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 2 {
+		t.Fatalf("expected one report per attempt, got %v", metrics)
+	}
+	host := strings.TrimPrefix(srv.URL, "http://")
+	for i, status := range []int{http.StatusServiceUnavailable, http.StatusOK} {
+		m := metrics[i]
+		if m.Method != "GET" || m.Host != host || m.Path != "/path" || m.StatusCode != status || m.Err != nil || m.Duration <= 0 {
+			t.Fatalf("unexpected metrics %d: %+v", i, m)
+		}
+	}
+
+	metrics = nil
+	cli.SetRetryPolicy(nil)
+	srv.Close()
+	if _, _, err := cli.Get(srv.URL, nil); err == nil || len(metrics) != 1 || metrics[0].Err == nil || metrics[0].StatusCode != 0 {
+		t.Fatalf("expected the error reported, got %v %+v", err, metrics)
+	}
+}
+
+func TestHMACSigner(t *testing.T) {
+	secret := []byte("s3cret")
+	var verified []bool
+	srv := newRecorder(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		bodyHash := sha256.Sum256(body)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(req.Method + "\n" + req.URL.RequestURI() + "\n" + req.Header.Get("X-Timestamp") + "\n" + hex.EncodeToString(bodyHash[:])))
+		signature, _ := hex.DecodeString(req.Header.Get("X-Signature"))
+		verified = append(verified, req.Header.Get("X-Key-Id") == "key-1" && hmac.Equal(signature, mac.Sum(nil)))
+	})
+	defer srv.Close()
+
+	cli := NewDefClient()
+	cli.SetInterceptors(SignInterceptor(HMACSigner("key-1", secret)))
+
+	if _, _, err := cli.PostJsonCtx(context.Background(), srv.URL+"/sign?b=2&a=1", map[string]string{"name": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := cli.GetCtx(context.Background(), srv.URL+"/sign"); err != nil {
+		t.Fatal(err)
+	}
+	if len(verified) != 2 || !verified[0] || !verified[1] {
+		t.Fatalf("signature not verified: %v", verified)
+	}
+
+	// a body that cannot be read twice is not sent unsigned
+	body := io.MultiReader(strings.NewReader("data"))
+	if _, _, err := cli.PostCtx(context.Background(), srv.URL, body); err == nil || !strings.Contains(err.Error(), "GetBody") || len(verified) != 2 {
+		t.Fatalf("expected a sign error, got %v", err)
+	}
+}
+
+func TestGetJSON(t *testing.T) {
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	srv := newRecorder(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/item":
+			io.WriteString(w, `{"id":7,"name":"<b>","extra":true}`)
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+		case "/blank":
+			io.WriteString(w, " \n")
+		case "/bad":
+			io.WriteString(w, `{"id":"x"}`)
+		case "/echo":
+			io.Copy(w, req.Body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, strings.Repeat("e", ErrorBodyLimit+100))
+		}
+	})
+	defer srv.Close()
+	cli := NewDefClient()
+	ctx := context.Background()
+
+	var out item
+	if err := cli.GetJSON(ctx, srv.URL+"/item", &out); err != nil || out != (item{ID: 7, Name: "<b>"}) {
+		t.Fatalf("unexpected decode: %v %+v", err, out)
+	}
+	if srv.last.Header.Get("Accept") != "application/json" {
+		t.Fatalf("expected Accept: application/json, got %q", srv.last.Header.Get("Accept"))
+	}
+
+	if err := cli.GetJSON(ctx, srv.URL+"/item", &out, WithStrictJSON()); err == nil || !strings.Contains(err.Error(), `unknown field "extra"`) {
+		t.Fatalf("expected the unknown field rejected, got %v", err)
+	}
+	if err := cli.GetJSON(ctx, srv.URL+"/bad", &out); err == nil || !strings.HasPrefix(err.Error(), "httpclient: decode GET "+srv.URL+"/bad: ") {
+		t.Fatalf("expected a decode error, got %v", err)
+	}
+
+	for _, path := range []string{"/empty", "/blank"} {
+		out = item{ID: 1}
+		if err := cli.GetJSON(ctx, srv.URL+path, &out); err != nil || out.ID != 1 {
+			t.Fatalf("%s: expected nil and out untouched, got %v %+v", path, err, out)
+		}
+	}
+	if err := cli.GetJSON(ctx, srv.URL+"/item", nil); err != nil {
+		t.Fatalf("expected a nil out to skip decoding, got %v", err)
+	}
+
+	u, _ := url.Parse(srv.URL + "/missing")
+	u.User = url.UserPassword("user", "pass")
+	err := cli.GetJSON(ctx, u.String(), &out, WithQuery("q", "1"))
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected *HTTPError, got %v", err)
+	}
+	wantURL := strings.Replace(srv.URL, "http://", "http://user:xxxxx@", 1) + "/missing?q=1"
+	if httpErr.Method != "GET" || httpErr.URL != wantURL || httpErr.StatusCode != http.StatusNotFound || httpErr.Status != "404 Not Found" {
+		t.Fatalf("unexpected error fields: %+v", httpErr)
+	}
+	if len(httpErr.Body) != ErrorBodyLimit || httpErr.Header.Get("Content-Type") == "" || strings.Contains(err.Error(), "pass@") {
+		t.Fatalf("unexpected error body or header: %d %v", len(httpErr.Body), httpErr.Header)
+	}
+
+	req, _ := http.NewRequest("POST", srv.URL+"/echo", nil)
+	var echo map[string]string
+	if err := cli.DoJSON(ctx, req, map[string]string{"html": "<a&b>"}, &echo); err != nil || echo["html"] != "<a&b>" {
+		t.Fatalf("unexpected echo: %v %v", err, echo)
+	}
+	if srv.last.Header.Get("Content-Type") != "application/json" || srv.last.ContentLength != int64(len(`{"html":"<a&b>"}`+"\n")) {
+		t.Fatalf("unexpected request: %v %d", srv.last.Header, srv.last.ContentLength)
+	}
+	if req.Body != nil || len(req.Header) > 0 {
+		t.Fatal("DoJSON modified the caller's request")
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	// requests still in flight don't dilute the failure ratio
+	b := &breaker{host: "h", config: &BreakerConfig{MinRequests: 2, FailureRatio: 1, Window: time.Minute, OpenTimeout: time.Minute}}
+	first, _ := b.allow()
+	second, _ := b.allow()
+	b.allow()
+	b.done(first, true)
+	b.done(second, true)
+	if b.currentState() != StateOpen {
+		t.Fatalf("expected open after 2 of 2 completed requests failed, got %s", b.currentState())
+	}
+
+	// a request sent in the last window doesn't count in the new one
+	b = &breaker{host: "h", config: &BreakerConfig{MinRequests: 1, FailureRatio: 1, Window: 20 * time.Millisecond, OpenTimeout: time.Minute}}
+	old, _ := b.allow()
+	time.Sleep(30 * time.Millisecond)
+	current, _ := b.allow()
+	b.done(old, true)
+	if b.currentState() != StateClosed {
+		t.Fatal("a result from the last window opened the breaker")
+	}
+	b.done(current, true)
+	if b.currentState() != StateOpen {
+		t.Fatalf("expected open, got %s", b.currentState())
+	}
+}
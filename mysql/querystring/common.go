@@ -1,9 +1,90 @@
 package querystring
 
 import (
+	"fmt"
+	"strings"
 	"unicode/utf8"
 )
 
+// rawValue is written into the statement as is, in both modes, e.g. DEFAULT
+// or NOW().
+type rawValue string
+
+const defaultValue = rawValue("DEFAULT")
+
+// sqlWriter renders a statement either with inline escaped values or with
+// "?" placeholders whose arguments are collected in order.
+type sqlWriter struct {
+	buf   strings.Builder
+	param bool
+	args  []interface{}
+	err   error
+}
+
+func newSQLWriter(param bool) *sqlWriter {
+	return &sqlWriter{param: param}
+}
+
+func (this *sqlWriter) WriteString(s string) {
+	this.buf.WriteString(s)
+}
+
+// WriteValue writes value through the shared encoder, the first value that
+// can't be encoded is kept in Err.
+func (this *sqlWriter) WriteValue(value interface{}) {
+	if raw, ok := value.(rawValue); ok {
+		this.buf.WriteString(string(raw))
+		return
+	}
+	if this.param {
+		arg, err := encodeArg(value)
+		if err != nil {
+			this.setErr(err)
+			return
+		}
+		this.buf.WriteByte('?')
+		this.args = append(this.args, arg)
+		return
+	}
+	literal, err := encodeValue(value)
+	if err != nil {
+		this.setErr(err)
+		return
+	}
+	this.buf.WriteString(literal)
+}
+
+func (this *sqlWriter) setErr(err error) {
+	if this.err == nil {
+		this.err = err
+	}
+}
+
+func (this *sqlWriter) Len() int {
+	return this.buf.Len()
+}
+
+func (this *sqlWriter) String() string {
+	return this.buf.String()
+}
+
+func (this *sqlWriter) Args() []interface{} {
+	return this.args
+}
+
+func (this *sqlWriter) Err() error {
+	return this.err
+}
+
+// mustBuild backs GetSQL and GetParamSQL, which have no error to return; use
+// BuildSQL or BuildParamSQL to get the error instead of a panic.
+func mustBuild(query string, args []interface{}, err error) (string, []interface{}) {
+	if err != nil {
+		panic(fmt.Sprintf("querystring[GetSQL] %s", err.Error()))
+	}
+	return query, args
+}
+
 func Escape(sql string) string {
 	dest := make([]byte, 0, 2*len(sql))
 	var escape byte
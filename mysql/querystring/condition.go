@@ -0,0 +1,393 @@
+package querystring
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// InChunkSize splits IN / NOT IN lists longer than this many values into
+// several predicates joined by OR / AND. 0 disables chunking.
+var InChunkSize = 0
+
+// Condition is a WHERE predicate. Conditions are built with the package level
+// EQ, NE, GT, ..., and can be nested with And, Or and Not.
+type Condition interface {
+	writeTo(w *sqlWriter)
+}
+
+type rawWhere string
+
+func (this rawWhere) writeTo(w *sqlWriter) {
+	if len(strings.TrimSpace(string(this))) == 0 {
+		// an empty predicate filters nothing, keep the statement valid
+		w.WriteString("1 = 1")
+		return
+	}
+	w.WriteString(string(this))
+}
+
+// alwaysTrue reports whether cond is known to match every row: a blank raw
+// predicate, an empty NOT IN list, the Not of a predicate that never matches,
+// or a group made of such predicates. It backs the UPDATE/DELETE full table
+// guard and errs on the side of false.
+func alwaysTrue(cond Condition) bool {
+	switch v := cond.(type) {
+	case rawWhere:
+		switch strings.ToUpper(strings.Join(strings.Fields(string(v)), "")) {
+		case "", "1=1", "1", "TRUE":
+			return true
+		}
+	case *inWhere:
+		return v.not && len(v.values) == 0
+	case *groupWhere:
+		if v.logic == "OR" {
+			for _, c := range v.conds {
+				if alwaysTrue(c) {
+					return true
+				}
+			}
+			return false
+		}
+		return allTrue(v.conds)
+	case *notWhere:
+		return alwaysFalse(v.cond)
+	}
+	return false
+}
+
+// alwaysFalse reports whether cond is known to match no row: a 1 = 0 raw
+// predicate, an empty IN list, the Not of an always true predicate, or a
+// group made of such predicates.
+func alwaysFalse(cond Condition) bool {
+	switch v := cond.(type) {
+	case rawWhere:
+		switch strings.ToUpper(strings.Join(strings.Fields(string(v)), "")) {
+		case "1=0", "0", "FALSE":
+			return true
+		}
+	case *inWhere:
+		return !v.not && len(v.values) == 0
+	case *groupWhere:
+		if v.logic == "OR" {
+			for _, c := range v.conds {
+				if !alwaysFalse(c) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, c := range v.conds {
+			if alwaysFalse(c) {
+				return true
+			}
+		}
+		return false
+	case *notWhere:
+		return alwaysTrue(v.cond)
+	}
+	return false
+}
+
+// allTrue reports whether the conjunction of conds matches every row, which
+// holds for an empty list.
+func allTrue(conds []Condition) bool {
+	for _, c := range conds {
+		if !alwaysTrue(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// errWhere carries an error found while building a condition to BuildSQL.
+type errWhere struct {
+	err error
+}
+
+func (this *errWhere) writeTo(w *sqlWriter) {
+	w.setErr(this.err)
+	w.WriteString("1 = 0")
+}
+
+type compareWhere struct {
+	field string
+	cmp   string
+	value interface{}
+}
+
+// writeTo renders = NULL and != NULL, which never match, as IS NULL and
+// IS NOT NULL; any other comparison with NULL is an error.
+func (this *compareWhere) writeTo(w *sqlWriter) {
+	if value, err := normalizeValue(this.value); err == nil && value == nil {
+		switch this.cmp {
+		case "=":
+			w.WriteString(this.field + " IS NULL")
+		case "!=":
+			w.WriteString(this.field + " IS NOT NULL")
+		default:
+			w.setErr(fmt.Errorf("querystring[%s] %s compared with NULL never matches", this.cmp, this.field))
+			w.WriteString("1 = 0")
+		}
+		return
+	}
+
+	w.WriteString(fmt.Sprintf("%s %s ", this.field, this.cmp))
+	w.WriteValue(this.value)
+}
+
+type inWhere struct {
+	field  string
+	not    bool
+	values []interface{}
+}
+
+func (this *inWhere) writeTo(w *sqlWriter) {
+	if len(this.values) == 0 {
+		// IN () is a syntax error in MySQL, render the predicate's meaning instead
+		if this.not {
+			w.WriteString("1 = 1")
+		} else {
+			w.WriteString("1 = 0")
+		}
+		return
+	}
+
+	if InChunkSize <= 0 || len(this.values) <= InChunkSize {
+		this.writeList(w, this.values)
+		return
+	}
+
+	logic := " OR "
+	if this.not {
+		logic = " AND "
+	}
+	w.WriteString("(")
+	for start := 0; start < len(this.values); start += InChunkSize {
+		end := start + InChunkSize
+		if end > len(this.values) {
+			end = len(this.values)
+		}
+		if start > 0 {
+			w.WriteString(logic)
+		}
+		this.writeList(w, this.values[start:end])
+	}
+	w.WriteString(")")
+}
+
+func (this *inWhere) writeList(w *sqlWriter, values []interface{}) {
+	if this.not {
+		w.WriteString(fmt.Sprintf("%s NOT IN (", this.field))
+	} else {
+		w.WriteString(fmt.Sprintf("%s IN (", this.field))
+	}
+	for i, v := range values {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.WriteValue(v)
+	}
+	w.WriteString(")")
+}
+
+type nullWhere struct {
+	field string
+	not   bool
+}
+
+func (this *nullWhere) writeTo(w *sqlWriter) {
+	if this.not {
+		w.WriteString(fmt.Sprintf("%s IS NOT NULL", this.field))
+	} else {
+		w.WriteString(fmt.Sprintf("%s IS NULL", this.field))
+	}
+}
+
+type betweenWhere struct {
+	field string
+	min   interface{}
+	max   interface{}
+}
+
+func (this *betweenWhere) writeTo(w *sqlWriter) {
+	w.WriteString(fmt.Sprintf("%s BETWEEN ", this.field))
+	w.WriteValue(this.min)
+	w.WriteString(" AND ")
+	w.WriteValue(this.max)
+}
+
+type subqueryWhere struct {
+	field string
+	op    string
+	sub   *selectSQL
+}
+
+func (this *subqueryWhere) writeTo(w *sqlWriter) {
+	if len(this.field) > 0 {
+		w.WriteString(fmt.Sprintf("%s %s (", this.field, this.op))
+	} else {
+		w.WriteString(fmt.Sprintf("%s (", this.op))
+	}
+	this.sub.writeTo(w)
+	w.WriteString(")")
+}
+
+type groupWhere struct {
+	logic string
+	conds []Condition
+}
+
+func (this *groupWhere) writeTo(w *sqlWriter) {
+	if len(this.conds) == 0 {
+		// an empty AND matches everything, an empty OR matches nothing
+		if this.logic == "OR" {
+			w.WriteString("1 = 0")
+		} else {
+			w.WriteString("1 = 1")
+		}
+		return
+	}
+	if len(this.conds) == 1 {
+		writeCondition(w, this.conds[0])
+		return
+	}
+	w.WriteString("(")
+	for i, v := range this.conds {
+		if i > 0 {
+			w.WriteString(" " + this.logic + " ")
+		}
+		writeCondition(w, v)
+	}
+	w.WriteString(")")
+}
+
+type notWhere struct {
+	cond Condition
+}
+
+func (this *notWhere) writeTo(w *sqlWriter) {
+	w.WriteString("NOT ")
+	// a group of two or more conditions brings its own parentheses
+	if group, ok := this.cond.(*groupWhere); ok && len(group.conds) > 1 {
+		this.cond.writeTo(w)
+		return
+	}
+	w.WriteString("(")
+	this.cond.writeTo(w)
+	w.WriteString(")")
+}
+
+// writeCondition wraps raw strings in parentheses so that an OR inside a
+// hand written predicate can't leak into the surrounding group.
+func writeCondition(w *sqlWriter, cond Condition) {
+	if _, ok := cond.(rawWhere); ok {
+		w.WriteString("(")
+		cond.writeTo(w)
+		w.WriteString(")")
+		return
+	}
+	cond.writeTo(w)
+}
+
+func Raw(where string) Condition {
+	return rawWhere(where)
+}
+
+func And(conds ...Condition) Condition {
+	return &groupWhere{logic: "AND", conds: conds}
+}
+
+func Or(conds ...Condition) Condition {
+	return &groupWhere{logic: "OR", conds: conds}
+}
+
+func Not(cond Condition) Condition {
+	return &notWhere{cond: cond}
+}
+
+func EQ(field string, value interface{}) Condition {
+	return &compareWhere{field: field, cmp: "=", value: value}
+}
+
+func NE(field string, value interface{}) Condition {
+	return &compareWhere{field: field, cmp: "!=", value: value}
+}
+
+func GT(field string, value interface{}) Condition {
+	return &compareWhere{field: field, cmp: ">", value: value}
+}
+
+func GE(field string, value interface{}) Condition {
+	return &compareWhere{field: field, cmp: ">=", value: value}
+}
+
+func LT(field string, value interface{}) Condition {
+	return &compareWhere{field: field, cmp: "<", value: value}
+}
+
+func LE(field string, value interface{}) Condition {
+	return &compareWhere{field: field, cmp: "<=", value: value}
+}
+
+func Like(field string, pattern string) Condition {
+	return &compareWhere{field: field, cmp: "LIKE", value: pattern}
+}
+
+func NotLike(field string, pattern string) Condition {
+	return &compareWhere{field: field, cmp: "NOT LIKE", value: pattern}
+}
+
+func IsNull(field string) Condition {
+	return &nullWhere{field: field}
+}
+
+func IsNotNull(field string) Condition {
+	return &nullWhere{field: field, not: true}
+}
+
+// newInWhere accepts any slice or array, e.g. []int64, []string, []time.Time
+// or a slice of driver.Valuer.
+func newInWhere(field string, not bool, values interface{}) Condition {
+	valueof := reflect.ValueOf(values)
+	if valueof.Kind() == reflect.Ptr {
+		valueof = valueof.Elem()
+	}
+	if valueof.Kind() != reflect.Slice && valueof.Kind() != reflect.Array {
+		return &errWhere{err: fmt.Errorf("querystring[IN] %s: %T is not a slice", field, values)}
+	}
+
+	valueArray := make([]interface{}, valueof.Len())
+	for i := range valueArray {
+		valueArray[i] = valueof.Index(i).Interface()
+	}
+	return &inWhere{field: field, not: not, values: valueArray}
+}
+
+func IN(field string, values interface{}) Condition {
+	return newInWhere(field, false, values)
+}
+
+func NotIn(field string, values interface{}) Condition {
+	return newInWhere(field, true, values)
+}
+
+func Between(field string, min interface{}, max interface{}) Condition {
+	return &betweenWhere{field: field, min: min, max: max}
+}
+
+func InSubquery(field string, sub *selectSQL) Condition {
+	return &subqueryWhere{field: field, op: "IN", sub: sub}
+}
+
+func NotInSubquery(field string, sub *selectSQL) Condition {
+	return &subqueryWhere{field: field, op: "NOT IN", sub: sub}
+}
+
+func Exists(sub *selectSQL) Condition {
+	return &subqueryWhere{op: "EXISTS", sub: sub}
+}
+
+func NotExists(sub *selectSQL) Condition {
+	return &subqueryWhere{op: "NOT EXISTS", sub: sub}
+}
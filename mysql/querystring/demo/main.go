@@ -1,5 +1,267 @@
+// Command demo generates a typed repository for a struct with db tags, built
+// on the querystring builders. Add to the file declaring the struct:
+//
+//	//go:generate go run go-api-server/util/mysql/querystring/demo -type User -table users
+//
+// It writes user_repo.go next to it with FindByPK, FindWhere, Insert,
+// BatchInsert, UpdateByPK, DeleteByPK and Count. Columns come from the
+// `db:"name,pk,auto_increment,readonly"` tags of the struct's own fields.
+// UpdateByPK is left out when every column is part of the primary key.
 package main
 
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+type column struct {
+	Name          string
+	Field         string
+	Type          string
+	PK            bool
+	AutoIncrement bool
+	Readonly      bool
+}
+
+type repo struct {
+	Package    string
+	ImportPath string
+	Type       string
+	Table      string
+	PK         []*column
+	AutoField  *column
+	Updatable  []*column
+}
+
 func main() {
+	typeName := flag.String("type", "", "struct type to generate a repository for")
+	table := flag.String("table", "", "table name, defaults to the snake_case type name")
+	file := flag.String("file", os.Getenv("GOFILE"), "go file declaring the type")
+	output := flag.String("output", "", "output file, defaults to <type>_repo.go")
+	importPath := flag.String("import", "go-api-server/util/mysql/querystring", "import path of querystring")
+	flag.Parse()
+
+	log.SetFlags(0)
+	log.SetPrefix("querystring demo: ")
+	if len(*typeName) == 0 || len(*file) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if len(*table) == 0 {
+		*table = snakeCase(*typeName)
+	}
+	if len(*output) == 0 {
+		*output = filepath.Join(filepath.Dir(*file), snakeCase(*typeName)+"_repo.go")
+	}
+
+	src, err := generate(*file, *typeName, *table, *importPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate returns the formatted repository source of typeName in file.
+func generate(file string, typeName string, table string, importPath string) ([]byte, error) {
+	r, err := parseRepo(file, typeName)
+	if err != nil {
+		return nil, err
+	}
+	r.Table = table
+	r.ImportPath = importPath
+
+	var buf bytes.Buffer
+	if err := repoTemplate.Execute(&buf, r); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %v\n%s", err, buf.String())
+	}
+	return src, nil
+}
+
+func parseRepo(file string, typeName string) (*repo, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var st *ast.StructType
+	ast.Inspect(f, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok && spec.Name.Name == typeName {
+			st, _ = spec.Type.(*ast.StructType)
+			return false
+		}
+		return st == nil
+	})
+	if st == nil {
+		return nil, fmt.Errorf("struct %s not found in %s", typeName, file)
+	}
+
+	r := &repo{Package: f.Name.Name, Type: typeName}
+	for _, field := range st.Fields.List {
+		if field.Tag == nil || len(field.Names) == 0 {
+			continue
+		}
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return nil, err
+		}
+		options := strings.FieldsFunc(reflect.StructTag(tag).Get("db"), func(r rune) bool { return r == ',' || r == ' ' })
+		if len(options) == 0 || options[0] == "-" {
+			continue
+		}
+
+		for _, name := range field.Names {
+			c := &column{Name: options[0], Field: name.Name, Type: types.ExprString(field.Type)}
+			for _, v := range options[1:] {
+				switch strings.ToLower(v) {
+				case "pk":
+					c.PK = true
+				case "auto_increment":
+					c.AutoIncrement = true
+				case "readonly":
+					c.Readonly = true
+				}
+			}
+			if c.PK {
+				r.PK = append(r.PK, c)
+			}
+			if c.AutoIncrement && r.AutoField == nil {
+				r.AutoField = c
+			}
+			if !c.PK && !c.AutoIncrement && !c.Readonly {
+				r.Updatable = append(r.Updatable, c)
+			}
+		}
+	}
+
+	if len(r.PK) == 0 {
+		return nil, fmt.Errorf("struct %s has no pk column", typeName)
+	}
+	return r, nil
+}
+
+func snakeCase(s string) string {
+	var buf strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				buf.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// paramName turns a field name into a parameter name: ID -> id, UserID -> userID.
+func paramName(s string) string {
+	runes := []rune(s)
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	name := string(runes)
+	if token.IsKeyword(name) {
+		name += "_"
+	}
+	return name
+}
+
+var repoTemplate = template.Must(template.New("repo").Funcs(template.FuncMap{
+	"lower": paramName,
+}).Parse(`// Code generated by querystring demo; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+
+	"{{.ImportPath}}"
+)
+
+const {{lower .Type}}Table = "{{.Table}}"
+
+// {{.Type}}Repo is the CRUD repository of {{.Type}} on table {{.Table}}.
+type {{.Type}}Repo struct {
+	db querystring.Executor
+}
+
+func New{{.Type}}Repo(db querystring.Executor) *{{.Type}}Repo {
+	return &{{.Type}}Repo{db: db}
+}
+
+// WithTx returns a repository running on tx, e.g. inside querystring.WithTx.
+func (this *{{.Type}}Repo) WithTx(tx querystring.Executor) *{{.Type}}Repo {
+	return &{{.Type}}Repo{db: tx}
+}
+
+func (this *{{.Type}}Repo) FindByPK(ctx context.Context{{range .PK}}, {{lower .Field}} {{.Type}}{{end}}) ({{.Type}}, bool, error) {
+	return querystring.SelectAs[{{.Type}}]({{lower .Type}}Table){{range .PK}}.EQ("{{.Name}}", {{lower .Field}}){{end}}.Limit(1).One(ctx, this.db)
+}
+
+func (this *{{.Type}}Repo) FindWhere(ctx context.Context, conds ...querystring.Condition) ([]{{.Type}}, error) {
+	return querystring.SelectAs[{{.Type}}]({{lower .Type}}Table).WhereCond(conds...).All(ctx, this.db)
+}
+
+func (this *{{.Type}}Repo) Count(ctx context.Context, conds ...querystring.Condition) (int64, error) {
+	return querystring.Count({{lower .Type}}Table).WhereCond(conds...).QueryCount(ctx, this.db)
+}
+
+{{if .AutoField}}// Insert adds obj and sets its {{.AutoField.Field}} to the generated id.
+{{end}}func (this *{{.Type}}Repo) Insert(ctx context.Context, obj *{{.Type}}) error {
+	{{if .AutoField}}_, id, err := querystring.InsertInto({{lower .Type}}Table).SetObject(obj).Exec(ctx, this.db)
+	if err != nil {
+		return err
+	}
+	obj.{{.AutoField.Field}} = {{.AutoField.Type}}(id)
+	return nil{{else}}_, _, err := querystring.InsertInto({{lower .Type}}Table).SetObject(obj).Exec(ctx, this.db)
+	return err{{end}}
+}
+
+func (this *{{.Type}}Repo) BatchInsert(ctx context.Context, objs []{{.Type}}) (int64, error) {
+	if len(objs) == 0 {
+		return 0, nil
+	}
+	affected, _, err := querystring.InsertInto({{lower .Type}}Table).SetObjects(objs).MaxRows(500).Exec(ctx, this.db)
+	return affected, err
+}
+
+{{if .Updatable}}func (this *{{.Type}}Repo) UpdateByPK(ctx context.Context, obj *{{.Type}}) (int64, error) {
+	affected, _, err := querystring.Update({{lower .Type}}Table).{{range .Updatable}}
+		Set("{{.Name}}", obj.{{.Field}}).{{end}}{{range .PK}}
+		EQ("{{.Name}}", obj.{{.Field}}).{{end}}
+		Exec(ctx, this.db)
+	return affected, err
+}
 
+{{end}}func (this *{{.Type}}Repo) DeleteByPK(ctx context.Context{{range .PK}}, {{lower .Field}} {{.Type}}{{end}}) (int64, error) {
+	affected, _, err := querystring.Delete({{lower .Type}}Table).{{range .PK}}
+		EQ("{{.Name}}", {{lower .Field}}).{{end}}
+		Exec(ctx, this.db)
+	return affected, err
 }
+`))
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerateGolden(t *testing.T) {
+	cases := []struct {
+		typeName string
+		table    string
+	}{
+		{"User", "users"},
+		{"UserRole", "user_role"},
+	}
+
+	for _, c := range cases {
+		src, err := generate(filepath.Join("testdata", "model.go"), c.typeName, c.table, "go-api-server/util/mysql/querystring")
+		if err != nil {
+			t.Fatalf("%s: %v", c.typeName, err)
+		}
+
+		golden := filepath.Join("testdata", snakeCase(c.typeName)+"_repo.golden")
+		if *update {
+			if err := os.WriteFile(golden, src, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(src) != string(want) {
+			t.Errorf("%s: generated code differs from %s, rerun with -update and review the diff:\n%s", c.typeName, golden, src)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	if _, err := generate(filepath.Join("testdata", "model.go"), "Missing", "t", "q"); err == nil {
+		t.Error("expected error for a missing type")
+	}
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+type User struct {
+	ID        int64      `db:"id,pk,auto_increment"`
+	Name      string     `db:"name"`
+	Type      int        `db:"type"`
+	DeletedAt *time.Time `db:"deleted_at"`
+	CreatedAt time.Time  `db:"created_at,readonly"`
+	Cache     string     `db:"-"`
+}
+
+type UserRole struct {
+	UserID int64 `db:"user_id,pk"`
+	RoleID int64 `db:"role_id,pk"`
+}
@@ -1,50 +1,65 @@
 package querystring
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"reflect"
-	"strings"
+	"sort"
+)
+
+var (
+	ErrFullTable   = errors.New("querystring: UPDATE/DELETE without WHERE, call AllowFullTable to run it")
+	ErrMaxAffected = errors.New("querystring: affected rows exceed the limit, rolled back")
 )
 
 type excuteSQL struct {
 	wherePtr    *whereMaker
-	updateArray []string
+	maxAffected int64
 }
 
 func Delete(table string) *excuteSQL {
 	return &excuteSQL{
-		wherePtr:    newWhereMaker("DELETE", table, ""),
-		updateArray: make([]string, 0),
+		wherePtr: newWhereMaker("DELETE", table, ""),
 	}
 }
 
 func Update(table string) *excuteSQL {
 	return &excuteSQL{
-		wherePtr:    newWhereMaker("UPDATE", table, ""),
-		updateArray: make([]string, 0),
+		wherePtr: newWhereMaker("UPDATE", table, ""),
 	}
 }
 
 func (this *excuteSQL) Set(field string, value interface{}) *excuteSQL {
-	valueof := reflect.ValueOf(value)
-	switch valueof.Type().Kind() {
-	case reflect.String:
-		this.updateArray = append(this.updateArray, fmt.Sprintf("%s = '%s'", field, Escape(valueof.String())))
-	case reflect.Bool:
-		this.updateArray = append(this.updateArray, fmt.Sprintf("%s = %t", field, valueof.Bool()))
-	case reflect.Int, reflect.Int32, reflect.Int64:
-		this.updateArray = append(this.updateArray, fmt.Sprintf("%s = %d", field, valueof.Int()))
-	case reflect.Uint, reflect.Uint32, reflect.Uint64:
-		this.updateArray = append(this.updateArray, fmt.Sprintf("%s = %d", field, valueof.Uint()))
-	case reflect.Float32, reflect.Float64:
-		this.updateArray = append(this.updateArray, fmt.Sprintf("%s = %f", field, valueof.Float()))
-	}
+	this.wherePtr.Set(field, value)
+	return this
+}
+
+// SetExpr assigns a raw SQL expression, e.g. SetExpr("updated_at", "NOW()").
+func (this *excuteSQL) SetExpr(field string, expr string) *excuteSQL {
+	this.wherePtr.Set(field, rawValue(expr))
+	return this
+}
+
+// Incr renders field = field + n.
+func (this *excuteSQL) Incr(field string, n interface{}) *excuteSQL {
+	this.wherePtr.SetWithOp(field, "+", n)
+	return this
+}
+
+// Decr renders field = field - n.
+func (this *excuteSQL) Decr(field string, n interface{}) *excuteSQL {
+	this.wherePtr.SetWithOp(field, "-", n)
 	return this
 }
 
 func (this *excuteSQL) SetFieldAndValue(fieldAndValue map[string]interface{}) *excuteSQL {
-	for k, v := range fieldAndValue {
-		this.Set(k, v)
+	fields := make([]string, 0, len(fieldAndValue))
+	for k := range fieldAndValue {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	for _, k := range fields {
+		this.Set(k, fieldAndValue[k])
 	}
 	return this
 }
@@ -54,6 +69,11 @@ func (this *excuteSQL) Where(where string) *excuteSQL {
 	return this
 }
 
+func (this *excuteSQL) WhereCond(conds ...Condition) *excuteSQL {
+	this.wherePtr.WhereCond(conds...)
+	return this
+}
+
 func (this *excuteSQL) EQ(field string, value interface{}) *excuteSQL {
 	this.wherePtr.EQ(field, value)
 	return this
@@ -79,18 +99,167 @@ func (this *excuteSQL) LE(field string, value interface{}) *excuteSQL {
 	return this
 }
 
-func (this *excuteSQL) IN(field string, intArray []int64) *excuteSQL {
-	this.wherePtr.IN(field, intArray)
+func (this *excuteSQL) IN(field string, values interface{}) *excuteSQL {
+	this.wherePtr.IN(field, values)
+	return this
+}
+
+func (this *excuteSQL) NE(field string, value interface{}) *excuteSQL {
+	this.wherePtr.NE(field, value)
+	return this
+}
+
+func (this *excuteSQL) Like(field string, pattern string) *excuteSQL {
+	this.wherePtr.Like(field, pattern)
+	return this
+}
+
+func (this *excuteSQL) NotLike(field string, pattern string) *excuteSQL {
+	this.wherePtr.NotLike(field, pattern)
+	return this
+}
+
+func (this *excuteSQL) IsNull(field string) *excuteSQL {
+	this.wherePtr.IsNull(field)
+	return this
+}
+
+func (this *excuteSQL) IsNotNull(field string) *excuteSQL {
+	this.wherePtr.IsNotNull(field)
+	return this
+}
+
+func (this *excuteSQL) NotIn(field string, values interface{}) *excuteSQL {
+	this.wherePtr.NotIn(field, values)
+	return this
+}
+
+func (this *excuteSQL) Between(field string, min interface{}, max interface{}) *excuteSQL {
+	this.wherePtr.Between(field, min, max)
+	return this
+}
+
+func (this *excuteSQL) InSubquery(field string, sub *selectSQL) *excuteSQL {
+	this.wherePtr.InSubquery(field, sub)
+	return this
+}
+
+func (this *excuteSQL) NotInSubquery(field string, sub *selectSQL) *excuteSQL {
+	this.wherePtr.NotInSubquery(field, sub)
+	return this
+}
+
+func (this *excuteSQL) Exists(sub *selectSQL) *excuteSQL {
+	this.wherePtr.Exists(sub)
+	return this
+}
+
+func (this *excuteSQL) NotExists(sub *selectSQL) *excuteSQL {
+	this.wherePtr.NotExists(sub)
+	return this
+}
+
+// AllowFullTable lets the statement render without a WHERE clause. Without
+// it an UPDATE or DELETE whose WHERE is missing or always true, e.g. a NotIn
+// with an empty list, fails with ErrFullTable.
+func (this *excuteSQL) AllowFullTable() *excuteSQL {
+	this.wherePtr.fullTable = true
+	return this
+}
+
+// MaxAffected makes Exec roll the statement back and return ErrMaxAffected
+// when it touches more than n rows. The statement runs in its own transaction,
+// or in a savepoint when ex already is a transaction.
+func (this *excuteSQL) MaxAffected(n int64) *excuteSQL {
+	this.maxAffected = n
+	return this
+}
+
+// Target names the tables a joined DELETE removes rows from, by default the
+// main table (or its alias).
+func (this *excuteSQL) Target(tables ...string) *excuteSQL {
+	this.wherePtr.targets = tables
+	return this
+}
+
+func (this *excuteSQL) InnerJoin(table string, on string) *excuteSQL {
+	this.wherePtr.InnerJoin(table, on)
+	return this
+}
+
+func (this *excuteSQL) LeftJoin(table string, on string) *excuteSQL {
+	this.wherePtr.LeftJoin(table, on)
+	return this
+}
+
+func (this *excuteSQL) RightJoin(table string, on string) *excuteSQL {
+	this.wherePtr.RightJoin(table, on)
+	return this
+}
+
+func (this *excuteSQL) CrossJoin(table string) *excuteSQL {
+	this.wherePtr.CrossJoin(table)
 	return this
 }
 
-func (this *excuteSQL) Between(field string, min int, max int) *excuteSQL {
-	this.wherePtr.GE(field, min)
-	this.wherePtr.LT(field, max)
+func (this *excuteSQL) StraightJoin(table string, on string) *excuteSQL {
+	this.wherePtr.StraightJoin(table, on)
+	return this
+}
+
+func (this *excuteSQL) OrderBy(order string) *excuteSQL {
+	this.wherePtr.OrderBy(order)
+	return this
+}
+
+func (this *excuteSQL) Limit(limit int64) *excuteSQL {
+	this.wherePtr.Limit(limit)
 	return this
 }
 
 func (this *excuteSQL) GetSQL() string {
-	this.wherePtr.fields = strings.Join(this.updateArray, ",")
-	return this.wherePtr.ToString()
+	query, _ := mustBuild(this.wherePtr.build(false))
+	return query
+}
+
+func (this *excuteSQL) GetParamSQL() (string, []interface{}) {
+	return mustBuild(this.wherePtr.build(true))
+}
+
+func (this *excuteSQL) BuildSQL() (string, error) {
+	query, _, err := this.wherePtr.build(false)
+	return query, err
+}
+
+func (this *excuteSQL) BuildParamSQL() (string, []interface{}, error) {
+	return this.wherePtr.build(true)
+}
+
+// Exec runs the statement and returns the number of affected rows and the
+// last insert id.
+func (this *excuteSQL) Exec(ctx context.Context, ex Executor) (int64, int64, error) {
+	query, args, err := this.BuildParamSQL()
+	if err != nil {
+		return 0, 0, err
+	}
+	if this.maxAffected <= 0 {
+		return execute(ctx, ex, query, args)
+	}
+
+	var affected, lastInsertId int64
+	err = WithTx(ctx, ex, nil, func(tx Executor) error {
+		n, id, err := execute(ctx, tx, query, args)
+		if err != nil {
+			return err
+		}
+		affected, lastInsertId = n, id
+		if affected > this.maxAffected {
+			return fmt.Errorf("%w: %d > %d", ErrMaxAffected, affected, this.maxAffected)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return affected, lastInsertId, nil
 }
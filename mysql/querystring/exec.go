@@ -0,0 +1,37 @@
+package querystring
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Executor is the subset of *sql.DB, *sql.Tx and *sql.Conn the builders need,
+// so the same statement can run on a pool, a connection or a transaction.
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+var (
+	_ Executor = (*sql.DB)(nil)
+	_ Executor = (*sql.Tx)(nil)
+	_ Executor = (*sql.Conn)(nil)
+)
+
+func execute(ctx context.Context, ex Executor, query string, args []interface{}) (int64, int64, error) {
+	result, err := ex.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	lastInsertId, err := result.LastInsertId()
+	if err != nil {
+		return affected, 0, err
+	}
+	return affected, lastInsertId, nil
+}
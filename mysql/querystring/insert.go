@@ -1,50 +1,310 @@
 package querystring
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 )
 
+var ErrEmptyInsert = errors.New("querystring: INSERT without rows")
+
 type insertSQL struct {
-	table      string
-	fieldArray []string
-	valueArray [][]string
+	command     string
+	table       string
+	fieldArray  []string
+	valueArray  [][]interface{}
+	updateArray []string
+	updateAll   bool
+	maxRows     int
+	maxBytes    int
 }
 
 func InsertInto(table string) *insertSQL {
 	return &insertSQL{
-		table:      table,
-		valueArray: make([][]string, 0),
+		command:     "INSERT",
+		table:       table,
+		fieldArray:  make([]string, 0),
+		valueArray:  make([][]interface{}, 0),
+		updateArray: make([]string, 0),
+	}
+}
+
+// Ignore renders INSERT IGNORE, skipping rows that hit a unique key.
+func (this *insertSQL) Ignore() *insertSQL {
+	this.command = "INSERT IGNORE"
+	return this
+}
+
+// Replace renders REPLACE INTO, deleting rows that hit a unique key first.
+func (this *insertSQL) Replace() *insertSQL {
+	this.command = "REPLACE"
+	return this
+}
+
+// OnDuplicateKeyUpdate overwrites fields with the inserted values when a row
+// hits a unique key. Without fields every inserted column is updated.
+func (this *insertSQL) OnDuplicateKeyUpdate(fields ...string) *insertSQL {
+	if len(fields) == 0 {
+		this.updateAll = true
 	}
+	this.updateArray = append(this.updateArray, fields...)
+	return this
+}
+
+// MaxRows splits the rows into statements of at most n rows each.
+func (this *insertSQL) MaxRows(n int) *insertSQL {
+	this.maxRows = n
+	return this
+}
+
+// MaxBytes splits the rows into statements whose estimated length stays under
+// n bytes, keep it below the server's max_allowed_packet.
+func (this *insertSQL) MaxBytes(n int) *insertSQL {
+	this.maxBytes = n
+	return this
 }
 
 func (this *insertSQL) GetSQL() string {
-	valueArray := make([]string, len(this.valueArray))
-	for i, v := range this.valueArray {
-		valueArray[i] = fmt.Sprintf("(%s)", strings.Join(v, ","))
+	query, _ := mustBuild(this.build(false, this.valueArray))
+	return query
+}
+
+func (this *insertSQL) GetParamSQL() (string, []interface{}) {
+	return mustBuild(this.build(true, this.valueArray))
+}
+
+func (this *insertSQL) BuildSQL() (string, error) {
+	query, _, err := this.build(false, this.valueArray)
+	return query, err
+}
+
+func (this *insertSQL) BuildParamSQL() (string, []interface{}, error) {
+	return this.build(true, this.valueArray)
+}
+
+// GetSQLArray returns one statement per batch, see MaxRows and MaxBytes.
+func (this *insertSQL) GetSQLArray() []string {
+	sqlArray, _, err := this.buildArray(false)
+	mustBuild("", nil, err)
+	return sqlArray
+}
+
+func (this *insertSQL) GetParamSQLArray() ([]string, [][]interface{}) {
+	sqlArray, argsArray, err := this.buildArray(true)
+	mustBuild("", nil, err)
+	return sqlArray, argsArray
+}
+
+func (this *insertSQL) build(param bool, rows [][]interface{}) (string, []interface{}, error) {
+	if len(this.fieldArray) == 0 || len(rows) == 0 {
+		return "", nil, ErrEmptyInsert
+	}
+	if this.command == "REPLACE" && (this.updateAll || len(this.updateArray) > 0) {
+		return "", nil, errors.New("querystring[REPLACE] can't take ON DUPLICATE KEY UPDATE")
+	}
+	w := newSQLWriter(param)
+	this.writeTo(w, rows)
+	return w.String(), w.Args(), w.Err()
+}
+
+func (this *insertSQL) buildArray(param bool) ([]string, [][]interface{}, error) {
+	batches := this.batches()
+	sqlArray := make([]string, len(batches))
+	argsArray := make([][]interface{}, len(batches))
+	for i, rows := range batches {
+		query, args, err := this.build(param, rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		sqlArray[i], argsArray[i] = query, args
+	}
+	return sqlArray, argsArray, nil
+}
+
+// Exec runs the statement and returns the number of affected rows and the
+// last insert id. A batch split into several statements runs in one
+// transaction when ex can begin one, and reports the first statement's id.
+func (this *insertSQL) Exec(ctx context.Context, ex Executor) (int64, int64, error) {
+	sqlArray, argsArray, err := this.buildArray(true)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(sqlArray) == 1 {
+		return execute(ctx, ex, sqlArray[0], argsArray[0])
+	}
+
+	var affected, lastInsertId int64
+	run := func(tx Executor) error {
+		affected, lastInsertId = 0, 0
+		for i, query := range sqlArray {
+			n, id, err := execute(ctx, tx, query, argsArray[i])
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				lastInsertId = id
+			}
+			affected += n
+		}
+		return nil
+	}
+
+	if _, ok := ex.(txBeginner); ok {
+		err = WithTx(ctx, ex, nil, run)
+	} else {
+		err = run(ex)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return affected, lastInsertId, nil
+}
+
+func (this *insertSQL) batches() [][][]interface{} {
+	if len(this.valueArray) == 0 || (this.maxRows <= 0 && this.maxBytes <= 0) {
+		return [][][]interface{}{this.valueArray}
+	}
+
+	size := 0
+	if this.maxBytes > 0 {
+		w := newSQLWriter(false)
+		this.writeTo(w, nil)
+		size = w.Len()
+	}
+
+	batches := make([][][]interface{}, 0)
+	start, batchSize := 0, size
+	for i, row := range this.valueArray {
+		rowSize := 0
+		if this.maxBytes > 0 {
+			w := newSQLWriter(false)
+			writeRow(w, row)
+			rowSize = w.Len() + 1
+		}
+		full := (this.maxRows > 0 && i-start >= this.maxRows) ||
+			(this.maxBytes > 0 && batchSize+rowSize > this.maxBytes)
+		if i > start && full {
+			batches = append(batches, this.valueArray[start:i])
+			start, batchSize = i, size
+		}
+		batchSize += rowSize
 	}
-	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", this.table,
-		strings.Join(this.fieldArray, ","),
-		strings.Join(valueArray, ","))
+	return append(batches, this.valueArray[start:])
 }
 
+func (this *insertSQL) writeTo(w *sqlWriter, rows [][]interface{}) {
+	w.WriteString(fmt.Sprintf("%s INTO %s (%s) VALUES ", this.command, this.table, strings.Join(this.fieldArray, ",")))
+	for i, row := range rows {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		writeRow(w, row)
+	}
+
+	updateArray := this.updateArray
+	if this.updateAll {
+		updateArray = this.fieldArray
+	}
+	if len(updateArray) > 0 {
+		w.WriteString(" ON DUPLICATE KEY UPDATE ")
+		for i, v := range updateArray {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			w.WriteString(fmt.Sprintf("%s = VALUES(%s)", v, v))
+		}
+	}
+}
+
+func writeRow(w *sqlWriter, row []interface{}) {
+	w.WriteString("(")
+	for i, v := range row {
+		if i > 0 {
+			w.WriteString(",")
+		}
+		w.WriteValue(v)
+	}
+	w.WriteString(")")
+}
+
+// SetFieldAndValue adds one row, its columns sorted by name.
 func (this *insertSQL) SetFieldAndValue(fieldAndValue map[string]interface{}) *insertSQL {
-	this.fieldArray = make([]string, len(fieldAndValue))
-	valueArray := make([]string, len(fieldAndValue))
-	index := 0
-	for k, v := range fieldAndValue {
-		this.fieldArray[index] = k
-		valueArray[index] = formatFieldValue(v)
-		index++
-	}
-	this.valueArray = append(this.valueArray, valueArray)
+	fields := make([]string, 0, len(fieldAndValue))
+	for k := range fieldAndValue {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	values := make([]interface{}, len(fields))
+	for i, k := range fields {
+		values[i] = fieldAndValue[k]
+	}
+	this.addRow(fields, values)
+	return this
+}
+
+// addRow appends a row keeping the columns in the order they were first seen,
+// so every row lines up with fieldArray. A column a row doesn't have is
+// written as DEFAULT.
+func (this *insertSQL) addRow(fields []string, values []interface{}) {
+	for _, field := range fields {
+		if this.fieldIndex(field) < 0 {
+			this.fieldArray = append(this.fieldArray, field)
+			for i := range this.valueArray {
+				this.valueArray[i] = append(this.valueArray[i], defaultValue)
+			}
+		}
+	}
+
+	row := make([]interface{}, len(this.fieldArray))
+	for i := range row {
+		row[i] = defaultValue
+	}
+	for i, field := range fields {
+		row[this.fieldIndex(field)] = values[i]
+	}
+	this.valueArray = append(this.valueArray, row)
+}
+
+func (this *insertSQL) fieldIndex(field string) int {
+	for i, v := range this.fieldArray {
+		if v == field {
+			return i
+		}
+	}
+	return -1
+}
+
+// Values adds several rows, see SetFieldAndValue.
+func (this *insertSQL) Values(rows ...map[string]interface{}) *insertSQL {
+	for _, row := range rows {
+		this.SetFieldAndValue(row)
+	}
+	return this
+}
+
+// SetObjects adds one row per element of a slice of structs or struct pointers.
+func (this *insertSQL) SetObjects(objects interface{}) *insertSQL {
+	valueof := reflect.ValueOf(objects)
+	if valueof.Kind() != reflect.Slice && valueof.Kind() != reflect.Array {
+		panic(fmt.Sprintf("querystring[SetObjects] %s is not a slice", valueof.Type()))
+	}
+	for i := 0; i < valueof.Len(); i++ {
+		v := valueof.Index(i)
+		if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+			panic(fmt.Sprintf("querystring[SetObjects] element %d of %s is nil", i, valueof.Type()))
+		}
+		this.SetObject(v.Interface())
+	}
 	return this
 }
 
 func (this *insertSQL) SetObject(object interface{}) *insertSQL {
-	this.fieldArray = make([]string, 0)
-	valueArray := make([]string, 0)
+	fields := make([]string, 0)
+	values := make([]interface{}, 0)
 
 	valueof := reflect.ValueOf(object)
 	if valueof.Type().Kind() == reflect.Ptr {
@@ -55,48 +315,22 @@ func (this *insertSQL) SetObject(object interface{}) *insertSQL {
 		panic(fmt.Sprintf("querystring[InsertObject] %s is not a struct", valueof.Type().Name()))
 	}
 
-	for i := 0; i < valueof.NumField(); i++ {
-		tags := valueof.Type().Field(i).Tag.Get("db")
-		if len(tags) == 0 {
+	for _, fi := range getStructInfo(valueof.Type()).fields {
+		if fi.autoIncrement || fi.readonly {
 			continue
 		}
-		tagArray := strings.Split(tags, ",")
-		if len(tagArray) > 0 && strings.ToLower(tagArray[1]) == "auto_increment" {
+		field := fieldValue(valueof, fi.index)
+		if fi.omitEmpty && (!field.IsValid() || field.IsZero()) {
 			continue
 		}
-		this.fieldArray = append(this.fieldArray, tagArray[0])
-		switch valueof.Type().Field(i).Type.Kind() {
-		case reflect.String:
-			valueArray = append(valueArray, fmt.Sprintf("'%s'", Escape(valueof.String())))
-		case reflect.Bool:
-			valueArray = append(valueArray, fmt.Sprintf("%t", valueof.Bool()))
-		case reflect.Int, reflect.Int32, reflect.Int64:
-			valueArray = append(valueArray, fmt.Sprintf("%d", valueof.Int()))
-		case reflect.Uint, reflect.Uint32, reflect.Uint64:
-			valueArray = append(valueArray, fmt.Sprintf("%d", valueof.Uint()))
-		case reflect.Float32, reflect.Float64:
-			valueArray = append(valueArray, fmt.Sprintf("%t", valueof.Bool()))
+		fields = append(fields, fi.column)
+		if field.IsValid() {
+			values = append(values, field.Interface())
+		} else {
+			values = append(values, nil)
 		}
 	}
 
-	this.valueArray = append(this.valueArray, valueArray)
-
+	this.addRow(fields, values)
 	return this
 }
-
-func formatFieldValue(value interface{}) string {
-	valueof := reflect.ValueOf(value)
-	switch valueof.Type().Kind() {
-	case reflect.String:
-		return fmt.Sprintf("'%s'", valueof.String())
-	case reflect.Bool:
-		return fmt.Sprintf("%t", valueof.Bool())
-	case reflect.Int, reflect.Int32, reflect.Int64:
-		return fmt.Sprintf("%d", valueof.Int())
-	case reflect.Uint, reflect.Uint32, reflect.Uint64:
-		return fmt.Sprintf("%d", valueof.Uint())
-	case reflect.Float32, reflect.Float64:
-		return fmt.Sprintf("%t", valueof.Bool())
-	}
-	return "''"
-}
@@ -0,0 +1,240 @@
+package querystring
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("querystring: invalid page cursor")
+
+type cursorField struct {
+	field string
+	desc  bool
+}
+
+func parseCursorFields(fields []string) ([]cursorField, error) {
+	cursorFields := make([]cursorField, len(fields))
+	for i, v := range fields {
+		words := strings.Fields(v)
+		if len(words) == 0 || len(words) > 2 {
+			return nil, fmt.Errorf("querystring: bad cursor field %q", v)
+		}
+		cursorFields[i].field = words[0]
+		if len(words) == 2 {
+			switch strings.ToUpper(words[1]) {
+			case "ASC":
+			case "DESC":
+				cursorFields[i].desc = true
+			default:
+				return nil, fmt.Errorf("querystring: bad cursor field %q", v)
+			}
+		}
+		if cursorFields[i].desc != cursorFields[0].desc {
+			return nil, errors.New("querystring: cursor fields must all sort the same way")
+		}
+	}
+	return cursorFields, nil
+}
+
+// Paginate switches the select to keyset pagination: rows are ordered by
+// cursorFields, e.g. []string{"created_at DESC", "id DESC"}, and the page
+// starts after the row the cursor points to, which is rendered as
+// (created_at, id) < (?, ?). Pass an empty cursor for the first page and read
+// the next one from QueryPage. The fields must identify a row uniquely.
+func (this *selectSQL) Paginate(cursorFields []string, cursor string, pageSize int64) *selectSQL {
+	if pageSize <= 0 {
+		this.wherePtr.WhereCond(&errWhere{err: fmt.Errorf("querystring[Paginate] page size %d is not positive", pageSize)})
+		return this
+	}
+	fields, err := parseCursorFields(cursorFields)
+	if err != nil {
+		this.wherePtr.WhereCond(&errWhere{err: err})
+		return this
+	}
+	this.wherePtr.cursorFields = fields
+
+	orderArray := make([]string, len(fields))
+	nameArray := make([]string, len(fields))
+	for i, v := range fields {
+		nameArray[i] = v.field
+		if v.desc {
+			orderArray[i] = v.field + " DESC"
+		} else {
+			orderArray[i] = v.field
+		}
+	}
+	this.wherePtr.OrderBy(strings.Join(orderArray, ","))
+	this.wherePtr.Offset(0)
+	this.wherePtr.Limit(pageSize)
+
+	if len(cursor) == 0 {
+		return this
+	}
+
+	values, err := decodeCursor(cursor)
+	if err != nil || len(values) != len(fields) {
+		this.wherePtr.WhereCond(&errWhere{err: ErrInvalidCursor})
+		return this
+	}
+	cmp := ">"
+	if fields[0].desc {
+		cmp = "<"
+	}
+	this.wherePtr.WhereCond(&rowCompareWhere{fields: nameArray, cmp: cmp, values: values})
+	return this
+}
+
+type rowCompareWhere struct {
+	fields []string
+	cmp    string
+	values []interface{}
+}
+
+func (this *rowCompareWhere) writeTo(w *sqlWriter) {
+	w.WriteString(fmt.Sprintf("(%s) %s (", strings.Join(this.fields, ", "), this.cmp))
+	for i, v := range this.values {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteValue(v)
+	}
+	w.WriteString(")")
+}
+
+// QueryPage runs a Paginate select into out, a pointer to a slice of structs,
+// and returns the cursor of the next page, empty on the last page.
+func (this *selectSQL) QueryPage(ctx context.Context, ex Executor, out interface{}) (string, error) {
+	if len(this.wherePtr.cursorFields) == 0 {
+		if _, _, err := this.BuildParamSQL(); err != nil {
+			return "", err
+		}
+		return "", errors.New("querystring: QueryPage needs Paginate")
+	}
+
+	count, err := this.QueryAll(ctx, ex, out)
+	if err != nil || count == 0 || int64(count) < this.wherePtr.limit {
+		return "", err
+	}
+
+	last := reflect.ValueOf(out).Elem().Index(count - 1)
+	if last.Kind() == reflect.Ptr {
+		last = last.Elem()
+	}
+	info := getStructInfo(last.Type())
+
+	values := make([]interface{}, len(this.wherePtr.cursorFields))
+	for i, v := range this.wherePtr.cursorFields {
+		column := v.field
+		if idx := strings.LastIndex(column, "."); idx >= 0 {
+			column = column[idx+1:]
+		}
+		fi, ok := info.columns[column]
+		if !ok {
+			return "", fmt.Errorf("querystring: cursor field %s is not a column of %s", v.field, last.Type())
+		}
+		field := fieldValue(last, fi.index)
+		if !field.IsValid() {
+			return "", fmt.Errorf("querystring: cursor field %s is nil", v.field)
+		}
+		values[i] = field.Interface()
+	}
+	return encodeCursor(values)
+}
+
+func encodeCursor(values []interface{}) (string, error) {
+	array := make([]interface{}, len(values))
+	for i, v := range values {
+		value, err := normalizeValue(v)
+		if err != nil {
+			return "", err
+		}
+		switch t := value.(type) {
+		case time.Time:
+			value = t.Format(datetimeFormat)
+		case []byte:
+			value = string(t)
+		}
+		array[i] = value
+	}
+
+	data, err := json.Marshal(array)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var array []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&array); err != nil {
+		return nil, err
+	}
+
+	for i, v := range array {
+		// keep BIGINT keys exact instead of going through float64
+		if n, ok := v.(json.Number); ok {
+			if x, err := n.Int64(); err == nil {
+				array[i] = x
+			} else if x, err := n.Float64(); err == nil {
+				array[i] = x
+			} else {
+				array[i] = n.String()
+			}
+		}
+	}
+	return array, nil
+}
+
+// CountQuery returns a Count select with the same FROM, JOIN and WHERE,
+// counting through a derived table when the select groups or is a union.
+func (this *selectSQL) CountQuery() *selectSQL {
+	src := this.wherePtr
+	if src.command != "SELECT" || src.distinct || len(src.group) > 0 || len(src.havingArray) > 0 {
+		sub := *src
+		sub.order, sub.start, sub.limit, sub.lock = "", 0, 0, ""
+		return CountFrom(&selectSQL{wherePtr: &sub})
+	}
+
+	count := *src
+	count.fields = "COUNT(*)"
+	count.order, count.start, count.limit, count.lock = "", 0, 0, ""
+	return &selectSQL{wherePtr: &count}
+}
+
+// Page runs the classic page/total pair: it counts the rows matching the
+// select, then scans page (1 based) of pageSize rows into out. The select
+// itself is left as is.
+func (this *selectSQL) Page(ctx context.Context, ex Executor, page int64, pageSize int64, out interface{}) (int64, error) {
+	if pageSize <= 0 {
+		return 0, fmt.Errorf("querystring[Page] page size %d is not positive", pageSize)
+	}
+	total, err := this.CountQuery().QueryCount(ctx, ex)
+	if err != nil {
+		return 0, err
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	query := *this.wherePtr
+	query.Offset((page - 1) * pageSize)
+	query.Limit(pageSize)
+	if _, err := (&selectSQL{wherePtr: &query}).QueryAll(ctx, ex, out); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
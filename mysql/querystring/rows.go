@@ -0,0 +1,116 @@
+package querystring
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrStop ends Each early without reporting an error.
+var ErrStop = errors.New("querystring: stop iteration")
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Rows is a cursor over a select that scans one struct at a time, so large
+// exports run in bounded memory. It must be closed.
+type Rows struct {
+	rows    *sql.Rows
+	columns []string
+}
+
+// Rows runs the select and returns a cursor over its result.
+func (this *selectSQL) Rows(ctx context.Context, ex Executor) (*Rows, error) {
+	query, args, err := this.BuildParamSQL()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := ex.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return &Rows{rows: rows, columns: columns}, nil
+}
+
+func (this *Rows) Next() bool {
+	return this.rows.Next()
+}
+
+// Scan fills the struct pointed to by out from the current row.
+func (this *Rows) Scan(out interface{}) error {
+	dest := reflect.ValueOf(out)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return errors.New(fmt.Sprintf("dest: %T is not a pointer", out))
+	}
+	dest = dest.Elem()
+	if dest.Kind() != reflect.Struct {
+		return errors.New(fmt.Sprintf("dest: %s is not a struct", dest.Type().Name()))
+	}
+	return this.scan(dest)
+}
+
+func (this *Rows) scan(dest reflect.Value) error {
+	return scanRow(this.rows, this.columns, getStructInfo(dest.Type()), dest)
+}
+
+func (this *Rows) Err() error {
+	return this.rows.Err()
+}
+
+func (this *Rows) Close() error {
+	return this.rows.Close()
+}
+
+// Each calls fn for every row. fn has the form func(obj T) error or
+// func(obj *T) error where T is a struct; each call gets a fresh value.
+// Returning ErrStop from fn ends the loop early with a nil error. The rows
+// are always closed and rows.Err() is reported.
+func (this *selectSQL) Each(ctx context.Context, ex Executor, fn interface{}) error {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 1 || fnType.NumOut() != 1 || fnType.Out(0) != errorType {
+		return errors.New(fmt.Sprintf("fn: %s is not a func(T) error", fnType))
+	}
+
+	memberType := fnType.In(0)
+	memberIsPtr := false
+	if memberType.Kind() == reflect.Ptr {
+		memberType = memberType.Elem()
+		memberIsPtr = true
+	}
+	if memberType.Kind() != reflect.Struct {
+		return errors.New(fmt.Sprintf("fn: %s is not a struct", memberType.Name()))
+	}
+
+	rows, err := this.Rows(ctx, ex)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		obj := reflect.New(memberType)
+		if err := rows.scan(obj.Elem()); err != nil {
+			return err
+		}
+
+		arg := obj
+		if !memberIsPtr {
+			arg = obj.Elem()
+		}
+		if out := fnValue.Call([]reflect.Value{arg})[0]; !out.IsNil() {
+			if err := out.Interface().(error); err != ErrStop {
+				return err
+			}
+			return nil
+		}
+	}
+	return rows.Err()
+}
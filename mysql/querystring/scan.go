@@ -0,0 +1,192 @@
+package querystring
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+	bytesType   = reflect.TypeOf([]byte(nil))
+)
+
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02",
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex that allocates nil embedded
+// struct pointers on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// scanRow scans the current row of rows into the struct dest. Columns
+// without a matching field are discarded.
+func scanRow(rows *sql.Rows, columns []string, info *structInfo, dest reflect.Value) error {
+	addrArray := make([]interface{}, len(columns))
+	for i, column := range columns {
+		fi, ok := info.columns[column]
+		if !ok {
+			addrArray[i] = new(sql.RawBytes)
+			continue
+		}
+		addrArray[i] = &fieldScanner{column: column, field: fieldByIndex(dest, fi.index)}
+	}
+	return rows.Scan(addrArray...)
+}
+
+// fieldScanner converts one column into a struct field. Fields implementing
+// sql.Scanner are handed the raw driver value, everything else is converted
+// here so that a bad value reports the column instead of being dropped.
+type fieldScanner struct {
+	column string
+	field  reflect.Value
+}
+
+func (this *fieldScanner) Scan(src interface{}) error {
+	if err := assignValue(this.field, src); err != nil {
+		return fmt.Errorf("column %s: %v", this.column, err)
+	}
+	return nil
+}
+
+func assignValue(field reflect.Value, src interface{}) error {
+	if field.Addr().Type().Implements(scannerType) {
+		return field.Addr().Interface().(sql.Scanner).Scan(src)
+	}
+
+	if field.Kind() == reflect.Ptr {
+		if src == nil {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		value := reflect.New(field.Type().Elem())
+		if err := assignValue(value.Elem(), src); err != nil {
+			return err
+		}
+		field.Set(value)
+		return nil
+	}
+
+	if src == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	if field.Type() == timeType {
+		t, err := asTime(src)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if field.Type() == bytesType {
+		switch v := src.(type) {
+		case []byte:
+			field.SetBytes(append([]byte(nil), v...))
+		case string:
+			field.SetBytes([]byte(v))
+		default:
+			field.SetBytes([]byte(asString(src)))
+		}
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(asString(src))
+		return nil
+	case reflect.Bool:
+		switch v := src.(type) {
+		case bool:
+			field.SetBool(v)
+			return nil
+		case int64:
+			field.SetBool(v != 0)
+			return nil
+		}
+		val, err := strconv.ParseBool(asString(src))
+		if err != nil {
+			return err
+		}
+		field.SetBool(val)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val, err := strconv.ParseInt(asString(src), 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(val)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val, err := strconv.ParseUint(asString(src), 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(val)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		val, err := strconv.ParseFloat(asString(src), field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(val)
+		return nil
+	}
+
+	return fmt.Errorf("unsupported conversion from %T to %s", src, field.Type())
+}
+
+func asString(src interface{}) string {
+	switch v := src.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	return fmt.Sprintf("%v", src)
+}
+
+func asTime(src interface{}) (time.Time, error) {
+	if t, ok := src.(time.Time); ok {
+		return t, nil
+	}
+
+	str := asString(src)
+	if strings.HasPrefix(str, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, str, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as time", str)
+}
@@ -1,11 +1,11 @@
 package querystring
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
 	"strings"
 )
 
@@ -32,32 +32,62 @@ func SelectArray(fieldArray []string, from string) *selectSQL {
 }
 
 func SelectObject(object interface{}, from string) *selectSQL {
-	fieldArray := make([]string, 0)
-	valueof := reflect.ValueOf(object)
-	if valueof.Type().Kind() == reflect.Ptr {
-		valueof = valueof.Elem()
+	vtype := reflect.TypeOf(object)
+	if vtype.Kind() == reflect.Ptr {
+		vtype = vtype.Elem()
 	}
-	if valueof.Type().Kind() != reflect.Struct {
-		panic(fmt.Sprintf("querystring[SelectObject] %s is not a struct", valueof.Type().Name()))
-	}
-	for i := 0; i < valueof.Type().NumField(); i++ {
-		tags := valueof.Type().Field(i).Tag.Get("db")
-		if len(tags) == 0 {
-			continue
-		}
-		tagArray := strings.Split(tags, ",")
-		fieldArray = append(fieldArray, tagArray[0])
+	if vtype.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("querystring[SelectObject] %s is not a struct", vtype.Name()))
 	}
 	return &selectSQL{
-		wherePtr: newWhereMaker("SELECT", from, strings.Join(fieldArray, ",")),
+		wherePtr: newWhereMaker("SELECT", from, strings.Join(getStructInfo(vtype).columnNames(), ",")),
 	}
 }
 
+// Distinct renders SELECT DISTINCT.
+func (this *selectSQL) Distinct() *selectSQL {
+	this.wherePtr.distinct = true
+	return this
+}
+
+// FromSubquery selects from the derived table sub named alias instead of the
+// table given to Select.
+func (this *selectSQL) FromSubquery(sub *selectSQL, alias string) *selectSQL {
+	this.wherePtr.fromSub = sub
+	this.wherePtr.table = alias
+	return this
+}
+
+// Union combines selects with UNION. OrderBy, Offset and Limit on the result
+// apply to the combined rows.
+func Union(selects ...*selectSQL) *selectSQL {
+	wherePtr := newWhereMaker("UNION", "", "")
+	wherePtr.unionArray = selects
+	return &selectSQL{wherePtr: wherePtr}
+}
+
+// UnionAll is Union keeping duplicate rows.
+func UnionAll(selects ...*selectSQL) *selectSQL {
+	wherePtr := newWhereMaker("UNION ALL", "", "")
+	wherePtr.unionArray = selects
+	return &selectSQL{wherePtr: wherePtr}
+}
+
+// CountFrom counts the rows of sub, e.g. a union or a grouped select.
+func CountFrom(sub *selectSQL) *selectSQL {
+	return Count("").FromSubquery(sub, "t")
+}
+
 func (this *selectSQL) Where(where string) *selectSQL {
 	this.wherePtr.Where(where)
 	return this
 }
 
+func (this *selectSQL) WhereCond(conds ...Condition) *selectSQL {
+	this.wherePtr.WhereCond(conds...)
+	return this
+}
+
 func (this *selectSQL) EQ(field string, value interface{}) *selectSQL {
 	this.wherePtr.EQ(field, value)
 	return this
@@ -83,14 +113,73 @@ func (this *selectSQL) LE(field string, value interface{}) *selectSQL {
 	return this
 }
 
-func (this *selectSQL) IN(field string, intArray []int64) *selectSQL {
-	this.wherePtr.IN(field, intArray)
+func (this *selectSQL) IN(field string, values interface{}) *selectSQL {
+	this.wherePtr.IN(field, values)
 	return this
 }
 
-func (this *selectSQL) Between(field string, min int, max int) *selectSQL {
-	this.wherePtr.GE(field, min)
-	this.wherePtr.LT(field, max)
+func (this *selectSQL) NE(field string, value interface{}) *selectSQL {
+	this.wherePtr.NE(field, value)
+	return this
+}
+
+func (this *selectSQL) Like(field string, pattern string) *selectSQL {
+	this.wherePtr.Like(field, pattern)
+	return this
+}
+
+func (this *selectSQL) NotLike(field string, pattern string) *selectSQL {
+	this.wherePtr.NotLike(field, pattern)
+	return this
+}
+
+func (this *selectSQL) IsNull(field string) *selectSQL {
+	this.wherePtr.IsNull(field)
+	return this
+}
+
+func (this *selectSQL) IsNotNull(field string) *selectSQL {
+	this.wherePtr.IsNotNull(field)
+	return this
+}
+
+func (this *selectSQL) NotIn(field string, values interface{}) *selectSQL {
+	this.wherePtr.NotIn(field, values)
+	return this
+}
+
+func (this *selectSQL) Between(field string, min interface{}, max interface{}) *selectSQL {
+	this.wherePtr.Between(field, min, max)
+	return this
+}
+
+func (this *selectSQL) Having(conds ...Condition) *selectSQL {
+	this.wherePtr.Having(conds...)
+	return this
+}
+
+func (this *selectSQL) InSubquery(field string, sub *selectSQL) *selectSQL {
+	this.wherePtr.InSubquery(field, sub)
+	return this
+}
+
+func (this *selectSQL) NotInSubquery(field string, sub *selectSQL) *selectSQL {
+	this.wherePtr.NotInSubquery(field, sub)
+	return this
+}
+
+func (this *selectSQL) Exists(sub *selectSQL) *selectSQL {
+	this.wherePtr.Exists(sub)
+	return this
+}
+
+func (this *selectSQL) NotExists(sub *selectSQL) *selectSQL {
+	this.wherePtr.NotExists(sub)
+	return this
+}
+
+func (this *selectSQL) InnerJoin(table string, on string) *selectSQL {
+	this.wherePtr.InnerJoin(table, on)
 	return this
 }
 
@@ -104,6 +193,31 @@ func (this *selectSQL) RightJoin(table string, on string) *selectSQL {
 	return this
 }
 
+func (this *selectSQL) CrossJoin(table string) *selectSQL {
+	this.wherePtr.CrossJoin(table)
+	return this
+}
+
+func (this *selectSQL) StraightJoin(table string, on string) *selectSQL {
+	this.wherePtr.StraightJoin(table, on)
+	return this
+}
+
+func (this *selectSQL) InnerJoinUsing(table string, columns ...string) *selectSQL {
+	this.wherePtr.InnerJoinUsing(table, columns...)
+	return this
+}
+
+func (this *selectSQL) LeftJoinUsing(table string, columns ...string) *selectSQL {
+	this.wherePtr.LeftJoinUsing(table, columns...)
+	return this
+}
+
+func (this *selectSQL) RightJoinUsing(table string, columns ...string) *selectSQL {
+	this.wherePtr.RightJoinUsing(table, columns...)
+	return this
+}
+
 func (this *selectSQL) GroupBy(group string) *selectSQL {
 	this.wherePtr.GroupBy(group)
 	return this
@@ -124,102 +238,135 @@ func (this *selectSQL) Limit(limit int64) *selectSQL {
 	return this
 }
 
+func (this *selectSQL) writeTo(w *sqlWriter) {
+	this.wherePtr.writeTo(w)
+}
+
+func (this *selectSQL) UseIndex(indexes ...string) *selectSQL {
+	return this.indexHint("USE INDEX", indexes)
+}
+
+func (this *selectSQL) ForceIndex(indexes ...string) *selectSQL {
+	return this.indexHint("FORCE INDEX", indexes)
+}
+
+func (this *selectSQL) IgnoreIndex(indexes ...string) *selectSQL {
+	return this.indexHint("IGNORE INDEX", indexes)
+}
+
+func (this *selectSQL) indexHint(hint string, indexes []string) *selectSQL {
+	this.wherePtr.hintArray = append(this.wherePtr.hintArray, fmt.Sprintf("%s (%s)", hint, strings.Join(indexes, ",")))
+	return this
+}
+
+// ForUpdate locks the selected rows for writing until the transaction ends.
+func (this *selectSQL) ForUpdate() *selectSQL {
+	this.wherePtr.lock = "FOR UPDATE"
+	return this
+}
+
+// ForUpdateNoWait fails at once instead of waiting for rows locked by another
+// transaction (MySQL 8.0+).
+func (this *selectSQL) ForUpdateNoWait() *selectSQL {
+	this.wherePtr.lock = "FOR UPDATE NOWAIT"
+	return this
+}
+
+// ForUpdateSkipLocked leaves rows locked by another transaction out of the
+// result (MySQL 8.0+).
+func (this *selectSQL) ForUpdateSkipLocked() *selectSQL {
+	this.wherePtr.lock = "FOR UPDATE SKIP LOCKED"
+	return this
+}
+
+func (this *selectSQL) LockInShareMode() *selectSQL {
+	this.wherePtr.lock = "LOCK IN SHARE MODE"
+	return this
+}
+
 func (this *selectSQL) GetSQL() string {
-	return this.wherePtr.ToString()
+	query, _ := mustBuild(this.wherePtr.build(false))
+	return query
+}
+
+func (this *selectSQL) GetParamSQL() (string, []interface{}) {
+	return mustBuild(this.wherePtr.build(true))
+}
+
+func (this *selectSQL) BuildSQL() (string, error) {
+	query, _, err := this.wherePtr.build(false)
+	return query, err
+}
+
+func (this *selectSQL) BuildParamSQL() (string, []interface{}, error) {
+	return this.wherePtr.build(true)
 }
 
 func (this *selectSQL) GetObject(out interface{}, db *sql.DB) (bool, error) {
-	dest := reflect.ValueOf(out)
+	return this.QueryOne(context.Background(), db, out)
+}
 
-	if dest.Type().Kind() == reflect.Ptr {
-		dest = dest.Elem()
-	}
+func (this *selectSQL) GetObjectArray(out interface{}, db *sql.DB) (int, error) {
+	return this.QueryAll(context.Background(), db, out)
+}
 
-	vtype := dest.Type()
-	if vtype.Kind() != reflect.Struct {
-		return false, errors.New(fmt.Sprintf("dest: %s is not a struct", vtype.Name()))
+func (this *selectSQL) GetCount(db *sql.DB) (int64, error) {
+	return this.QueryCount(context.Background(), db)
+}
+
+// QueryCount runs a single value select such as Count or CountFrom.
+func (this *selectSQL) QueryCount(ctx context.Context, ex Executor) (int64, error) {
+	query, args, err := this.BuildParamSQL()
+	if err != nil {
+		return 0, err
 	}
 
-	var fieldArray []string
-	if this.wherePtr.fields != "*" {
-		fieldArray = strings.Split(this.wherePtr.fields, ",")
-	} else {
-		for i := 0; i < vtype.NumField(); i++ {
-			tag := strings.Trim(vtype.Field(i).Tag.Get("db"), " ")
-			if len(tag) == 0 || tag == "-" {
-				continue
-			}
-			arr := strings.Split(tag, " ")
-			fieldArray = append(fieldArray, arr[0])
-		}
+	var count int64
+	if err := ex.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, err
 	}
-	fieldMapper := make(map[string]int)
-	for i, v := range fieldArray {
-		fieldMapper[v] = i
+	return count, nil
+}
+
+// QueryOne scans the first row into the struct pointed to by out and reports
+// whether a row was found.
+func (this *selectSQL) QueryOne(ctx context.Context, ex Executor, out interface{}) (bool, error) {
+	dest := reflect.ValueOf(out)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return false, errors.New(fmt.Sprintf("dest: %T is not a pointer", out))
 	}
+	dest = dest.Elem()
 
-	fieldCount := len(fieldArray)
-	valueArray := make([][]byte, fieldCount)
-	valueAddrArray := make([]interface{}, fieldCount)
-	for i := 0; i < fieldCount; i++ {
-		valueAddrArray[i] = &valueArray[i]
+	vtype := dest.Type()
+	if vtype.Kind() != reflect.Struct {
+		return false, errors.New(fmt.Sprintf("dest: %s is not a struct", vtype.Name()))
 	}
 
-	row := db.QueryRow(this.GetSQL())
-	err := row.Scan(valueAddrArray...)
+	rows, err := this.Rows(ctx, ex)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
-		}
 		return false, err
 	}
+	defer rows.Close()
 
-	for i := 0; i < vtype.NumField(); i++ {
-		tag := strings.Trim(vtype.Field(i).Tag.Get("db"), " ")
-		if len(tag) == 0 || tag == "-" {
-			continue
-		}
-		arr := strings.Split(tag, " ")
-		idx, ok := fieldMapper[arr[0]]
-		if !ok {
-			continue
-		}
-		str := string(valueArray[idx])
-		switch vtype.Field(i).Type.Kind() {
-		case reflect.String:
-			dest.Field(i).SetString(str)
-		case reflect.Bool:
-			val, err := strconv.ParseBool(str)
-			if err == nil {
-				dest.Field(i).SetBool(val)
-			}
-		case reflect.Float32, reflect.Float64:
-			val, err := strconv.ParseFloat(str, 64)
-			if err == nil {
-				dest.Field(i).SetFloat(val)
-			}
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			val, err := strconv.ParseInt(str, 0, 64)
-			if err == nil {
-				dest.Field(i).SetInt(val)
-			}
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			val, err := strconv.ParseUint(str, 0, 64)
-			if err == nil {
-				dest.Field(i).SetUint(val)
-			}
-		}
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	if err := rows.scan(dest); err != nil {
+		return false, err
 	}
 
-	return true, nil
+	return true, rows.Err()
 }
 
-func (this *selectSQL) GetObjectArray(out interface{}, db *sql.DB) (int, error) {
-	sliceType := reflect.TypeOf(out)
-	if sliceType.Kind() == reflect.Ptr {
-		sliceType = sliceType.Elem()
+// QueryAll scans every row into the slice of structs (or struct pointers)
+// pointed to by out and returns the number of rows.
+func (this *selectSQL) QueryAll(ctx context.Context, ex Executor, out interface{}) (int, error) {
+	dest := reflect.ValueOf(out)
+	if dest.Kind() != reflect.Ptr || dest.IsNil() {
+		return 0, errors.New(fmt.Sprintf("dest: %T is not a pointer", out))
 	}
 
+	sliceType := dest.Type().Elem()
 	if sliceType.Kind() != reflect.Slice {
 		return 0, errors.New(fmt.Sprintf("dest: %s is not a slice", sliceType.Name()))
 	}
@@ -230,92 +377,36 @@ func (this *selectSQL) GetObjectArray(out interface{}, db *sql.DB) (int, error)
 		memberType = memberType.Elem()
 		memberIsPtr = true
 	}
-
-	var fieldArray []string
-	if this.wherePtr.fields != "*" {
-		fieldArray = strings.Split(this.wherePtr.fields, ",")
-	} else {
-		for i := 0; i < sliceType.NumField(); i++ {
-			tag := strings.Trim(sliceType.Field(i).Tag.Get("db"), " ")
-			if len(tag) == 0 || tag == "-" {
-				continue
-			}
-			arr := strings.Split(tag, " ")
-			fieldArray = append(fieldArray, arr[0])
-		}
+	if memberType.Kind() != reflect.Struct {
+		return 0, errors.New(fmt.Sprintf("dest: %s is not a struct", memberType.Name()))
 	}
-	fieldMapper := make(map[string]int)
-	for i, v := range fieldArray {
-		fieldMapper[v] = i
-	}
-	fieldCount := len(fieldArray)
 
-	rows, err := db.Query(this.GetSQL())
+	rows, err := this.Rows(ctx, ex)
 	if err != nil {
 		return 0, err
 	}
+	defer rows.Close()
 
 	count := 0
 	array := reflect.MakeSlice(sliceType, 0, 0)
 
 	for rows.Next() {
-		valueArray := make([][]byte, fieldCount)
-		valueAddrArray := make([]interface{}, fieldCount)
-		for i := 0; i < fieldCount; i++ {
-			valueAddrArray[i] = &valueArray[i]
-		}
-		err := rows.Scan(valueAddrArray...)
-		if err != nil {
+		obj := reflect.New(memberType)
+		if err := rows.scan(obj.Elem()); err != nil {
 			return 0, err
 		}
 		count++
 
-		obj := reflect.New(memberType)
-		dest := obj.Elem()
-		for i := 0; i < memberType.NumField(); i++ {
-			tag := strings.Trim(memberType.Field(i).Tag.Get("db"), " ")
-			if len(tag) == 0 || tag == "-" {
-				continue
-			}
-			arr := strings.Split(tag, " ")
-			idx, ok := fieldMapper[arr[0]]
-			if !ok {
-				continue
-			}
-			str := string(valueArray[idx])
-			switch memberType.Field(i).Type.Kind() {
-			case reflect.String:
-				dest.Field(i).SetString(str)
-			case reflect.Bool:
-				val, err := strconv.ParseBool(str)
-				if err == nil {
-					dest.Field(i).SetBool(val)
-				}
-			case reflect.Float32, reflect.Float64:
-				val, err := strconv.ParseFloat(str, 64)
-				if err == nil {
-					dest.Field(i).SetFloat(val)
-				}
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				val, err := strconv.ParseInt(str, 0, 64)
-				if err == nil {
-					dest.Field(i).SetInt(val)
-				}
-			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-				val, err := strconv.ParseUint(str, 0, 64)
-				if err == nil {
-					dest.Field(i).SetUint(val)
-				}
-			}
-		}
 		if memberIsPtr {
 			array = reflect.Append(array, obj)
 		} else {
-			array = reflect.Append(array, dest)
+			array = reflect.Append(array, obj.Elem())
 		}
 	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
 
-	dest := reflect.ValueOf(out)
 	dest.Elem().Set(array)
 
 	return count, nil
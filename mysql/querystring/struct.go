@@ -0,0 +1,140 @@
+package querystring
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldInfo describes one struct field mapped by a `db` tag, for example
+// `db:"id,pk,auto_increment"`. Options may be separated by commas or spaces.
+type fieldInfo struct {
+	column        string
+	index         []int
+	pk            bool
+	autoIncrement bool
+	omitEmpty     bool
+	readonly      bool
+}
+
+type structInfo struct {
+	fields  []*fieldInfo
+	columns map[string]*fieldInfo
+}
+
+var structInfoCache sync.Map
+
+// getStructInfo returns the cached db tag metadata of vtype, including the
+// fields of embedded structs.
+func getStructInfo(vtype reflect.Type) *structInfo {
+	if info, ok := structInfoCache.Load(vtype); ok {
+		return info.(*structInfo)
+	}
+
+	info := &structInfo{
+		fields:  make([]*fieldInfo, 0),
+		columns: make(map[string]*fieldInfo),
+	}
+	info.collect(vtype, nil)
+	info.resolve()
+
+	actual, _ := structInfoCache.LoadOrStore(vtype, info)
+	return actual.(*structInfo)
+}
+
+func (this *structInfo) collect(vtype reflect.Type, index []int) {
+	for i := 0; i < vtype.NumField(); i++ {
+		field := vtype.Field(i)
+		path := append(append([]int{}, index...), i)
+		tag := strings.TrimSpace(field.Tag.Get("db"))
+
+		if len(tag) == 0 && field.Anonymous {
+			ftype := field.Type
+			if ftype.Kind() == reflect.Ptr {
+				ftype = ftype.Elem()
+			}
+			if ftype.Kind() == reflect.Struct && ftype != timeType {
+				this.collect(ftype, path)
+			}
+			continue
+		}
+
+		fi := parseTag(tag)
+		if fi == nil {
+			continue
+		}
+		fi.index = path
+		this.fields = append(this.fields, fi)
+	}
+}
+
+// resolve keeps one field per column following Go's embedding rules: the
+// shallowest field wins, and a column mapped twice at the same depth is
+// ambiguous and dropped, as encoding/json does.
+func (this *structInfo) resolve() {
+	depth := make(map[string]int)
+	count := make(map[string]int)
+	for _, fi := range this.fields {
+		d, ok := depth[fi.column]
+		if !ok || len(fi.index) < d {
+			depth[fi.column] = len(fi.index)
+			count[fi.column] = 1
+		} else if len(fi.index) == d {
+			count[fi.column]++
+		}
+	}
+
+	fields := this.fields[:0]
+	for _, fi := range this.fields {
+		if len(fi.index) == depth[fi.column] && count[fi.column] == 1 {
+			fields = append(fields, fi)
+			this.columns[fi.column] = fi
+		}
+	}
+	this.fields = fields
+}
+
+// fieldValue reads the field at index from v. It returns an invalid Value when
+// the path goes through a nil embedded struct pointer.
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func (this *structInfo) columnNames() []string {
+	names := make([]string, len(this.fields))
+	for i, v := range this.fields {
+		names[i] = v.column
+	}
+	return names
+}
+
+func parseTag(tag string) *fieldInfo {
+	options := strings.FieldsFunc(tag, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(options) == 0 || options[0] == "-" {
+		return nil
+	}
+
+	fi := &fieldInfo{column: options[0]}
+	for _, v := range options[1:] {
+		switch strings.ToLower(v) {
+		case "pk":
+			fi.pk = true
+		case "auto_increment":
+			fi.autoIncrement = true
+		case "omitempty":
+			fi.omitEmpty = true
+		case "readonly":
+			fi.readonly = true
+		}
+	}
+	return fi
+}
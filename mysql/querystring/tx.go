@@ -0,0 +1,143 @@
+package querystring
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	errLockWaitTimeout = 1205
+	errLockDeadlock    = 1213
+)
+
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxRetries is how many times the whole transaction is re-run after a
+	// deadlock or lock wait timeout.
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubled for every further
+	// retry and randomized by up to 50%.
+	Backoff time.Duration
+}
+
+var DefaultTxOptions = TxOptions{
+	MaxRetries: 3,
+	Backoff:    20 * time.Millisecond,
+}
+
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+var savepointSeq uint64
+
+// WithTx runs fn inside a transaction that is committed when fn returns nil
+// and rolled back when it returns an error or panics.
+//
+// When db can begin transactions (*sql.DB, *sql.Conn) a new transaction is
+// started and re-run on MySQL deadlock (1213) or lock wait timeout (1205).
+// Otherwise db is taken to be a running transaction, e.g. the tx passed to an
+// outer WithTx, and fn runs inside a savepoint of it.
+func WithTx(ctx context.Context, db Executor, opts *TxOptions, fn func(tx Executor) error) error {
+	beginner, ok := db.(txBeginner)
+	if !ok {
+		return withSavepoint(ctx, db, fn)
+	}
+
+	if opts == nil {
+		opts = &DefaultTxOptions
+	}
+	txOpts := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+
+	backoff := opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, beginner, txOpts, fn)
+		if err == nil || attempt >= opts.MaxRetries || !IsRetryableTxError(err) {
+			return err
+		}
+
+		if backoff > 0 {
+			delay := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+			backoff *= 2
+		}
+	}
+}
+
+func runTx(ctx context.Context, beginner txBeginner, opts *sql.TxOptions, fn func(tx Executor) error) (err error) {
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func withSavepoint(ctx context.Context, tx Executor, fn func(tx Executor) error) (err error) {
+	name := fmt.Sprintf("qs_sp_%d", atomic.AddUint64(&savepointSeq, 1))
+	if _, err = tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		// after a deadlock MySQL has already rolled back the whole transaction
+		// and the savepoint is gone, leave it to the outermost WithTx
+		if !IsRetryableTxError(err) {
+			tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		}
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+// IsRetryableTxError reports whether err is a MySQL deadlock or lock wait
+// timeout. The driver error is matched by its Number field so this package
+// doesn't depend on a particular driver.
+func IsRetryableTxError(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.Indirect(reflect.ValueOf(err))
+		if v.Kind() == reflect.Struct {
+			if f := v.FieldByName("Number"); f.IsValid() && f.Kind() >= reflect.Uint && f.Kind() <= reflect.Uint64 {
+				n := f.Uint()
+				return n == errLockDeadlock || n == errLockWaitTimeout
+			}
+		}
+		msg := err.Error()
+		if strings.HasPrefix(msg, fmt.Sprintf("Error %d", errLockDeadlock)) ||
+			strings.HasPrefix(msg, fmt.Sprintf("Error %d", errLockWaitTimeout)) {
+			return true
+		}
+	}
+	return false
+}
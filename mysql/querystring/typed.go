@@ -0,0 +1,170 @@
+package querystring
+
+import (
+	"context"
+	"reflect"
+)
+
+// TypedSelect is a select whose rows scan into T, a struct with db tags. It
+// wraps the untyped selectSQL, which Builder exposes for anything not
+// mirrored here.
+type TypedSelect[T any] struct {
+	sel *selectSQL
+}
+
+// SelectAs selects the db tagged columns of T from table, e.g.
+// SelectAs[User]("users").EQ("id", 1).One(ctx, db).
+func SelectAs[T any](from string) *TypedSelect[T] {
+	var zero T
+	return &TypedSelect[T]{sel: SelectObject(&zero, from)}
+}
+
+func (this *TypedSelect[T]) Builder() *selectSQL {
+	return this.sel
+}
+
+func (this *TypedSelect[T]) Where(where string) *TypedSelect[T] {
+	this.sel.Where(where)
+	return this
+}
+
+func (this *TypedSelect[T]) WhereCond(conds ...Condition) *TypedSelect[T] {
+	this.sel.WhereCond(conds...)
+	return this
+}
+
+func (this *TypedSelect[T]) EQ(field string, value interface{}) *TypedSelect[T] {
+	this.sel.EQ(field, value)
+	return this
+}
+
+func (this *TypedSelect[T]) NE(field string, value interface{}) *TypedSelect[T] {
+	this.sel.NE(field, value)
+	return this
+}
+
+func (this *TypedSelect[T]) GT(field string, value interface{}) *TypedSelect[T] {
+	this.sel.GT(field, value)
+	return this
+}
+
+func (this *TypedSelect[T]) GE(field string, value interface{}) *TypedSelect[T] {
+	this.sel.GE(field, value)
+	return this
+}
+
+func (this *TypedSelect[T]) LT(field string, value interface{}) *TypedSelect[T] {
+	this.sel.LT(field, value)
+	return this
+}
+
+func (this *TypedSelect[T]) LE(field string, value interface{}) *TypedSelect[T] {
+	this.sel.LE(field, value)
+	return this
+}
+
+func (this *TypedSelect[T]) Like(field string, pattern string) *TypedSelect[T] {
+	this.sel.Like(field, pattern)
+	return this
+}
+
+func (this *TypedSelect[T]) NotLike(field string, pattern string) *TypedSelect[T] {
+	this.sel.NotLike(field, pattern)
+	return this
+}
+
+func (this *TypedSelect[T]) IsNull(field string) *TypedSelect[T] {
+	this.sel.IsNull(field)
+	return this
+}
+
+func (this *TypedSelect[T]) IsNotNull(field string) *TypedSelect[T] {
+	this.sel.IsNotNull(field)
+	return this
+}
+
+func (this *TypedSelect[T]) IN(field string, values interface{}) *TypedSelect[T] {
+	this.sel.IN(field, values)
+	return this
+}
+
+func (this *TypedSelect[T]) NotIn(field string, values interface{}) *TypedSelect[T] {
+	this.sel.NotIn(field, values)
+	return this
+}
+
+func (this *TypedSelect[T]) Between(field string, min interface{}, max interface{}) *TypedSelect[T] {
+	this.sel.Between(field, min, max)
+	return this
+}
+
+func (this *TypedSelect[T]) OrderBy(order string) *TypedSelect[T] {
+	this.sel.OrderBy(order)
+	return this
+}
+
+func (this *TypedSelect[T]) Offset(pos int64) *TypedSelect[T] {
+	this.sel.Offset(pos)
+	return this
+}
+
+func (this *TypedSelect[T]) Limit(limit int64) *TypedSelect[T] {
+	this.sel.Limit(limit)
+	return this
+}
+
+func (this *TypedSelect[T]) ForUpdate() *TypedSelect[T] {
+	this.sel.ForUpdate()
+	return this
+}
+
+func (this *TypedSelect[T]) GetSQL() string {
+	return this.sel.GetSQL()
+}
+
+func (this *TypedSelect[T]) GetParamSQL() (string, []interface{}) {
+	return this.sel.GetParamSQL()
+}
+
+// One returns the first row and whether there was one.
+func (this *TypedSelect[T]) One(ctx context.Context, ex Executor) (T, bool, error) {
+	var obj T
+	ok, err := this.sel.QueryOne(ctx, ex, &obj)
+	return obj, ok, err
+}
+
+func (this *TypedSelect[T]) All(ctx context.Context, ex Executor) ([]T, error) {
+	array := make([]T, 0)
+	if _, err := this.sel.QueryAll(ctx, ex, &array); err != nil {
+		return nil, err
+	}
+	return array, nil
+}
+
+// Each streams the rows into fn, see selectSQL.Each.
+func (this *TypedSelect[T]) Each(ctx context.Context, ex Executor, fn func(obj T) error) error {
+	rows, err := this.sel.Rows(ctx, ex)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var obj T
+		if err := rows.scan(reflect.ValueOf(&obj).Elem()); err != nil {
+			return err
+		}
+		if err := fn(obj); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Count counts the rows matching the select, see selectSQL.CountQuery.
+func (this *TypedSelect[T]) Count(ctx context.Context, ex Executor) (int64, error) {
+	return this.sel.CountQuery().QueryCount(ctx, ex)
+}
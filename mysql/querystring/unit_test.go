@@ -1,10 +1,955 @@
 package querystring
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSelect(t *testing.T) {
 	sql := Select("a,b,c,d,e", "tbl").EQ("tblA.id", 1).LeftJoin("tblB", "tblA.id = tblB.aid").OrderBy("tblA.id DESC").GetSQL()
 	t.Logf("sql: %s", sql)
 }
+
+func TestParamSQL(t *testing.T) {
+	query, args := Select("a,b", "tbl").EQ("name", "o'neil").GT("age", 18).IN("id", []int64{1, 2}).GetParamSQL()
+	if query != "SELECT a,b FROM tbl WHERE name = ? AND age > ? AND id IN (?,?)" {
+		t.Fatalf("unexpected sql: %s", query)
+	}
+	if len(args) != 4 || args[0] != "o'neil" || args[1] != int64(18) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+
+	sql := Select("a,b", "tbl").EQ("name", "o'neil").GetSQL()
+	if sql != "SELECT a,b FROM tbl WHERE name = 'o\\'neil'" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+}
+
+func TestOperators(t *testing.T) {
+	cases := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"EQ", Select("*", "tbl").EQ("a", 1).GetSQL(), "SELECT * FROM tbl WHERE a = 1"},
+		{"NE", Select("*", "tbl").NE("a", 1).GetSQL(), "SELECT * FROM tbl WHERE a != 1"},
+		{"GT", Select("*", "tbl").GT("a", 1).GetSQL(), "SELECT * FROM tbl WHERE a > 1"},
+		{"GE", Select("*", "tbl").GE("a", 1).GetSQL(), "SELECT * FROM tbl WHERE a >= 1"},
+		{"LT", Select("*", "tbl").LT("a", 1).GetSQL(), "SELECT * FROM tbl WHERE a < 1"},
+		{"LE", Select("*", "tbl").LE("a", 1).GetSQL(), "SELECT * FROM tbl WHERE a <= 1"},
+		{"Like", Select("*", "tbl").Like("a", "x%").GetSQL(), "SELECT * FROM tbl WHERE a LIKE 'x%'"},
+		{"NotLike", Select("*", "tbl").NotLike("a", "x%").GetSQL(), "SELECT * FROM tbl WHERE a NOT LIKE 'x%'"},
+		{"IsNull", Select("*", "tbl").IsNull("a").GetSQL(), "SELECT * FROM tbl WHERE a IS NULL"},
+		{"IsNotNull", Select("*", "tbl").IsNotNull("a").GetSQL(), "SELECT * FROM tbl WHERE a IS NOT NULL"},
+		{"IN", Select("*", "tbl").IN("a", []int64{1, 2}).GetSQL(), "SELECT * FROM tbl WHERE a IN (1,2)"},
+		{"NotIn", Select("*", "tbl").NotIn("a", []int64{1, 2}).GetSQL(), "SELECT * FROM tbl WHERE a NOT IN (1,2)"},
+		{"Between", Select("*", "tbl").Between("a", 1, 10).GetSQL(), "SELECT * FROM tbl WHERE a BETWEEN 1 AND 10"},
+		{"EQNil", Select("*", "tbl").EQ("a", nil).GetSQL(), "SELECT * FROM tbl WHERE a IS NULL"},
+		{"EQNullString", Select("*", "tbl").EQ("a", sql.NullString{}).GetSQL(), "SELECT * FROM tbl WHERE a IS NULL"},
+		{"NENilPtr", Select("*", "tbl").NE("a", (*int)(nil)).GetSQL(), "SELECT * FROM tbl WHERE a IS NOT NULL"},
+		{"UpdateNE", Update("tbl").Set("b", 2).NE("a", 1).GetSQL(), "UPDATE tbl SET b = 2 WHERE a != 1"},
+		{"UpdateGT", Update("tbl").Set("b", 2).GT("a", 1).GetSQL(), "UPDATE tbl SET b = 2 WHERE a > 1"},
+		{"UpdateLike", Update("tbl").Set("b", 2).Like("a", "x%").GetSQL(), "UPDATE tbl SET b = 2 WHERE a LIKE 'x%'"},
+		{"DeleteIsNull", Delete("tbl").IsNull("a").GetSQL(), "DELETE FROM tbl WHERE a IS NULL"},
+		{"DeleteNotIn", Delete("tbl").NotIn("a", []int64{3}).GetSQL(), "DELETE FROM tbl WHERE a NOT IN (3)"},
+		{"DeleteBetween", Delete("tbl").Between("a", "2020-01-01", "2021-01-01").GetSQL(), "DELETE FROM tbl WHERE a BETWEEN '2020-01-01' AND '2021-01-01'"},
+	}
+
+	for _, c := range cases {
+		if c.sql != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, c.sql, c.want)
+		}
+	}
+
+	if _, err := Select("*", "tbl").GT("a", nil).BuildSQL(); err == nil {
+		t.Error("expected error for > NULL")
+	}
+}
+
+func TestConditionGroup(t *testing.T) {
+	cond := Or(EQ("a", 1), And(GT("b", 2), Like("c", "x%")))
+
+	sql := Select("*", "tbl").WhereCond(cond).EQ("d", "y").GetSQL()
+	if sql != "SELECT * FROM tbl WHERE (a = 1 OR (b > 2 AND c LIKE 'x%')) AND d = 'y'" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	query, args := Update("tbl").Set("e", 0).WhereCond(cond).GetParamSQL()
+	if query != "UPDATE tbl SET e = ? WHERE (a = ? OR (b > ? AND c LIKE ?))" || len(args) != 4 {
+		t.Fatalf("unexpected sql: %s %v", query, args)
+	}
+
+	sql = Delete("tbl").WhereCond(Not(Or(IsNull("a"), Raw("b = 1 OR c = 2")))).GetSQL()
+	if sql != "DELETE FROM tbl WHERE NOT (a IS NULL OR (b = 1 OR c = 2))" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	for cond, want := range map[Condition]string{
+		Not(EQ("a", 1)):                      "NOT (a = 1)",
+		Not(And(EQ("a", 1))):                 "NOT (a = 1)",
+		Not(Or(NotIn("a", []int{1, 2, 3}))):  "NOT (a NOT IN (1,2,3))",
+		Not(And()):                           "NOT (1 = 1)",
+		Not(And(EQ("a", 1), EQ("b", 2))):     "NOT (a = 1 AND b = 2)",
+		Not(Not(Or(EQ("a", 1), EQ("b", 2)))): "NOT (NOT (a = 1 OR b = 2))",
+	} {
+		if sql := Select("*", "tbl").WhereCond(cond).GetSQL(); sql != "SELECT * FROM tbl WHERE "+want {
+			t.Errorf("unexpected sql: %s, want %s", sql, want)
+		}
+	}
+}
+
+func TestIN(t *testing.T) {
+	sql := Select("*", "tbl").IN("id", []int64{10, 20}).IN("name", []string{"a", "b"}).GetSQL()
+	if sql != "SELECT * FROM tbl WHERE id IN (10,20) AND name IN ('a','b')" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	sql = Select("*", "tbl").IN("id", []uint32{}).NotIn("uid", []float64{}).GetSQL()
+	if sql != "SELECT * FROM tbl WHERE 1 = 0 AND 1 = 1" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	for _, values := range []interface{}{nil, 1, "a", (*[]int)(nil)} {
+		if _, err := Select("*", "tbl").IN("id", values).BuildSQL(); err == nil {
+			t.Fatalf("expected error for IN %#v", values)
+		}
+	}
+
+	InChunkSize = 2
+	defer func() { InChunkSize = 0 }()
+	query, args := Select("*", "tbl").IN("id", []int{1, 2, 3}).GetParamSQL()
+	if query != "SELECT * FROM tbl WHERE (id IN (?,?) OR id IN (?))" || len(args) != 3 {
+		t.Fatalf("unexpected sql: %s %v", query, args)
+	}
+}
+
+type scanBase struct {
+	ID int64 `db:"id"`
+}
+
+type scanObject struct {
+	scanBase
+	Name      sql.NullString `db:"name"`
+	Age       *int           `db:"age"`
+	Data      []byte         `db:"data"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func TestScanFields(t *testing.T) {
+	var obj scanObject
+	dest := reflect.ValueOf(&obj).Elem()
+	info := getStructInfo(dest.Type())
+	values := map[string]interface{}{
+		"id":         []byte("42"),
+		"name":       []byte("tom"),
+		"age":        nil,
+		"data":       []byte{0x01, 0x02},
+		"created_at": []byte("2024-05-06 07:08:09"),
+	}
+	for column, value := range values {
+		scanner := &fieldScanner{column: column, field: fieldByIndex(dest, info.columns[column].index)}
+		if err := scanner.Scan(value); err != nil {
+			t.Fatalf("scan %s: %v", column, err)
+		}
+	}
+	if obj.ID != 42 || obj.Name.String != "tom" || obj.Age != nil || len(obj.Data) != 2 || obj.CreatedAt.Year() != 2024 {
+		t.Fatalf("unexpected object: %+v", obj)
+	}
+
+	scanner := &fieldScanner{column: "id", field: fieldByIndex(dest, info.columns["id"].index)}
+	if err := scanner.Scan([]byte("abc")); err == nil || !strings.Contains(err.Error(), "column id") {
+		t.Fatalf("expected conversion error, got %v", err)
+	}
+}
+
+type tagObject struct {
+	ID      int64   `db:"id,pk,auto_increment"`
+	Name    string  `db:"name omitempty"`
+	Version int     `db:"version,readonly"`
+	Score   float64 `db:"score"`
+	Ignored string  `db:"-"`
+}
+
+func TestStructTags(t *testing.T) {
+	sql := SelectObject(&tagObject{}, "tbl").GetSQL()
+	if sql != "SELECT id,name,version,score FROM tbl" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	sql = InsertInto("tbl").SetObject(&tagObject{ID: 1, Version: 2, Score: 1.5}).GetSQL()
+	if sql != "INSERT INTO tbl (score) VALUES (1.5)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	info := getStructInfo(reflect.TypeOf(tagObject{}))
+	if !info.columns["id"].pk || !info.columns["id"].autoIncrement || info != getStructInfo(reflect.TypeOf(tagObject{})) {
+		t.Fatalf("unexpected struct info: %+v", info.columns["id"])
+	}
+}
+
+type shadowBase struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+	Code string `db:"code"`
+}
+
+type shadowOther struct {
+	Code string `db:"code"`
+}
+
+type shadowObject struct {
+	shadowBase
+	*shadowOther
+	ID string `db:"id"`
+}
+
+func TestStructTagsShadowed(t *testing.T) {
+	info := getStructInfo(reflect.TypeOf(shadowObject{}))
+	if fmt.Sprint(info.columnNames()) != "[name id]" || fmt.Sprint(info.columns["id"].index) != "[2]" || info.columns["code"] != nil {
+		t.Fatalf("unexpected columns: %v id=%v", info.columnNames(), info.columns["id"].index)
+	}
+
+	obj := &shadowObject{shadowBase: shadowBase{ID: 1, Name: "a"}, ID: "outer"}
+	sql := InsertInto("tbl").SetObject(obj).GetSQL()
+	if sql != "INSERT INTO tbl (name,id) VALUES ('a','outer')" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	dest := reflect.ValueOf(obj).Elem()
+	scanner := &fieldScanner{column: "id", field: fieldByIndex(dest, info.columns["id"].index)}
+	if err := scanner.Scan([]byte("scanned")); err != nil || obj.ID != "scanned" || obj.shadowBase.ID != 1 {
+		t.Fatalf("scanned into the wrong field: %v %+v", err, obj)
+	}
+}
+
+type fakeMySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (this *fakeMySQLError) Error() string {
+	return this.Message
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	if !IsRetryableTxError(fmt.Errorf("update: %w", &fakeMySQLError{Number: 1213, Message: "deadlock"})) {
+		t.Fatal("deadlock should be retryable")
+	}
+	if IsRetryableTxError(&fakeMySQLError{Number: 1062, Message: "duplicate"}) {
+		t.Fatal("duplicate key should not be retryable")
+	}
+	if !IsRetryableTxError(errors.New("Error 1205 (HY000): Lock wait timeout exceeded")) {
+		t.Fatal("lock wait timeout should be retryable")
+	}
+}
+
+// fakeDriver serves the same rows for every query, count for a COUNT(*)
+// one, and counts how many result sets were closed. It logs BEGIN, COMMIT,
+// ROLLBACK and every statement; an Exec fails with the next of execErrs if
+// any and affects affected rows.
+type fakeDriver struct {
+	columns  []string
+	rows     [][]driver.Value
+	count    int64
+	closed   int
+	log      []string
+	execErrs []error
+	affected int64
+}
+
+func (this *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{driver: this}, nil
+}
+
+func (this *fakeDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return this.Open("")
+}
+
+func (this *fakeDriver) Driver() driver.Driver {
+	return this
+}
+
+var savepointNameRegexp = regexp.MustCompile(`qs_sp_\d+`)
+
+// history returns the log with savepoint names made stable, and clears it.
+func (this *fakeDriver) history() string {
+	history := savepointNameRegexp.ReplaceAllString(strings.Join(this.log, "; "), "qs_sp_N")
+	this.log = nil
+	return history
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (this *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{driver: this.driver, query: query}, nil
+}
+
+func (this *fakeConn) Close() error {
+	return nil
+}
+
+func (this *fakeConn) Begin() (driver.Tx, error) {
+	this.driver.log = append(this.driver.log, "BEGIN")
+	return &fakeTx{driver: this.driver}, nil
+}
+
+type fakeTx struct {
+	driver *fakeDriver
+}
+
+func (this *fakeTx) Commit() error {
+	this.driver.log = append(this.driver.log, "COMMIT")
+	return nil
+}
+
+func (this *fakeTx) Rollback() error {
+	this.driver.log = append(this.driver.log, "ROLLBACK")
+	return nil
+}
+
+type fakeStmt struct {
+	driver *fakeDriver
+	query  string
+}
+
+func (this *fakeStmt) Close() error {
+	return nil
+}
+
+func (this *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (this *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	this.driver.log = append(this.driver.log, this.query)
+	if len(this.driver.execErrs) > 0 {
+		err := this.driver.execErrs[0]
+		this.driver.execErrs = this.driver.execErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fakeResult(this.driver.affected), nil
+}
+
+func (this *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	this.driver.log = append(this.driver.log, this.query)
+	if strings.HasPrefix(this.query, "SELECT COUNT(*)") {
+		return &fakeRows{driver: this.driver, columns: []string{"COUNT(*)"}, rows: [][]driver.Value{{this.driver.count}}}, nil
+	}
+	return &fakeRows{driver: this.driver, columns: this.driver.columns, rows: this.driver.rows}, nil
+}
+
+type fakeResult int64
+
+func (this fakeResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (this fakeResult) RowsAffected() (int64, error) {
+	return int64(this), nil
+}
+
+func TestWithTx(t *testing.T) {
+	fake := &fakeDriver{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	ctx := context.Background()
+	update := func(tx Executor) error {
+		_, err := tx.ExecContext(ctx, "UPDATE a")
+		return err
+	}
+
+	err := WithTx(ctx, db, nil, update)
+	if history := fake.history(); err != nil || history != "BEGIN; UPDATE a; COMMIT" {
+		t.Fatalf("unexpected commit: %v %s", err, history)
+	}
+
+	failed := errors.New("failed")
+	err = WithTx(ctx, db, nil, func(tx Executor) error {
+		update(tx)
+		return failed
+	})
+	if history := fake.history(); err != failed || history != "BEGIN; UPDATE a; ROLLBACK" {
+		t.Fatalf("unexpected rollback: %v %s", err, history)
+	}
+
+	func() {
+		defer func() {
+			if p, history := recover(), fake.history(); p != "boom" || history != "BEGIN; ROLLBACK" {
+				t.Fatalf("unexpected panic: %v %s", p, history)
+			}
+		}()
+		WithTx(ctx, db, nil, func(tx Executor) error { panic("boom") })
+	}()
+
+	// deadlocks re-run the whole transaction with a doubling backoff
+	attempts := 0
+	start := time.Now()
+	err = WithTx(ctx, db, &TxOptions{MaxRetries: 3, Backoff: 2 * time.Millisecond}, func(tx Executor) error {
+		attempts++
+		if attempts < 3 {
+			return &fakeMySQLError{Number: 1213, Message: "deadlock"}
+		}
+		return update(tx)
+	})
+	history := fake.history()
+	if err != nil || attempts != 3 || time.Since(start) < 6*time.Millisecond ||
+		history != "BEGIN; ROLLBACK; BEGIN; ROLLBACK; BEGIN; UPDATE a; COMMIT" {
+		t.Fatalf("unexpected retry: %v attempts=%d %s", err, attempts, history)
+	}
+
+	attempts = 0
+	err = WithTx(ctx, db, &TxOptions{MaxRetries: 2}, func(tx Executor) error {
+		attempts++
+		return &fakeMySQLError{Number: 1205, Message: "lock wait timeout"}
+	})
+	if !IsRetryableTxError(err) || attempts != 3 {
+		t.Fatalf("unexpected give up: %v attempts=%d", err, attempts)
+	}
+	fake.history()
+
+	attempts = 0
+	WithTx(ctx, db, nil, func(tx Executor) error {
+		attempts++
+		return failed
+	})
+	if attempts != 1 {
+		t.Fatalf("retried a non retryable error %d times", attempts)
+	}
+	fake.history()
+
+	// a WithTx on a running transaction nests in a savepoint
+	err = WithTx(ctx, db, nil, func(tx Executor) error {
+		if err := WithTx(ctx, tx, nil, update); err != nil {
+			return err
+		}
+		if err := WithTx(ctx, tx, nil, func(tx Executor) error { return failed }); err != failed {
+			t.Errorf("unexpected savepoint error: %v", err)
+		}
+		return nil
+	})
+	want := "BEGIN; SAVEPOINT qs_sp_N; UPDATE a; RELEASE SAVEPOINT qs_sp_N; SAVEPOINT qs_sp_N; ROLLBACK TO SAVEPOINT qs_sp_N; COMMIT"
+	if history = fake.history(); err != nil || history != want {
+		t.Fatalf("unexpected savepoints: %v %s", err, history)
+	}
+}
+
+func TestBatchInsert(t *testing.T) {
+	sql := InsertInto("tbl").Values(
+		map[string]interface{}{"b": 2, "a": 1},
+		map[string]interface{}{"a": 3, "c": "x"},
+	).OnDuplicateKeyUpdate("b").GetSQL()
+	if sql != "INSERT INTO tbl (a,b,c) VALUES (1,2,DEFAULT),(3,DEFAULT,'x') ON DUPLICATE KEY UPDATE b = VALUES(b)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	if _, err := InsertInto("tbl").BuildSQL(); err != ErrEmptyInsert {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := InsertInto("tbl").SetObjects([]tagObject{}).Exec(context.Background(), nil); err != ErrEmptyInsert {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := InsertInto("tbl").Replace().OnDuplicateKeyUpdate().SetObject(&tagObject{Score: 1}).BuildSQL(); err == nil || !strings.Contains(err.Error(), "REPLACE") {
+		t.Fatalf("expected error for REPLACE with ON DUPLICATE KEY UPDATE, got %v", err)
+	}
+	func() {
+		defer func() {
+			if p := recover(); p == nil || !strings.Contains(fmt.Sprint(p), "querystring[SetObjects] element 1") {
+				t.Fatalf("unexpected panic: %v", p)
+			}
+		}()
+		InsertInto("tbl").SetObjects([]*tagObject{{Score: 1}, nil})
+	}()
+
+	sql = InsertInto("tbl").Ignore().SetObjects([]tagObject{{Score: 1}, {Name: "n", Score: 2}}).GetSQL()
+	if sql != "INSERT IGNORE INTO tbl (score,name) VALUES (1,DEFAULT),(2,'n')" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	sqlArray, argsArray := InsertInto("tbl").Replace().MaxRows(2).Values(
+		map[string]interface{}{"a": 1},
+		map[string]interface{}{"a": 2},
+		map[string]interface{}{"a": 3},
+	).GetParamSQLArray()
+	if len(sqlArray) != 2 || sqlArray[0] != "REPLACE INTO tbl (a) VALUES (?),(?)" || len(argsArray[1]) != 1 {
+		t.Fatalf("unexpected batches: %v %v", sqlArray, argsArray)
+	}
+
+	sqlArray = InsertInto("tbl").MaxBytes(46).Values(
+		map[string]interface{}{"a": "aaaa"},
+		map[string]interface{}{"a": "bbbb"},
+		map[string]interface{}{"a": "cccc"},
+	).GetSQLArray()
+	if len(sqlArray) != 2 || sqlArray[0] != "INSERT INTO tbl (a) VALUES ('aaaa'),('bbbb')" {
+		t.Fatalf("unexpected batches: %q", sqlArray)
+	}
+}
+
+type jsonValue struct {
+	A int `json:"a"`
+}
+
+func (this jsonValue) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"a":%d}`, this.A)), nil
+}
+
+func TestEncodeValue(t *testing.T) {
+	name := "x"
+	date := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, "NULL"},
+		{(*string)(nil), "NULL"},
+		{&name, "'x'"},
+		{1.5, "1.5"},
+		{float32(1.1), "1.1"},
+		{uint8(7), "7"},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "'2024-01-02 03:04:05'"},
+		{&date, "'2024-01-02 03:04:05'"},
+		{(*time.Time)(nil), "NULL"},
+		{&jsonValue{A: 1}, `'{\"a\":1}'`},
+		{[]byte{0xde, 0xad}, "X'dead'"},
+		{jsonValue{A: 1}, `'{\"a\":1}'`},
+		{sql.NullInt64{Int64: 3, Valid: true}, "3"},
+		{sql.NullString{}, "NULL"},
+	}
+	for _, c := range cases {
+		got, err := encodeValue(c.value)
+		if err != nil || got != c.want {
+			t.Errorf("encodeValue(%#v) = %q, %v, want %q", c.value, got, err, c.want)
+		}
+	}
+
+	if arg, err := encodeArg(&date); err != nil || arg != date {
+		t.Errorf("encodeArg(*time.Time) = %#v, %v", arg, err)
+	}
+
+	if _, err := encodeValue(struct{}{}); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+	if _, err := Update("tbl").Set("a", map[string]int{}).EQ("id", 1).BuildSQL(); err == nil || err.Error() != "querystring: unsupported value type map[string]int" {
+		t.Errorf("expected BuildSQL error for unsupported type, got %v", err)
+	}
+}
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestClauseGolden renders every combination of SELECT clauses and compares
+// the result with testdata/clauses.golden. Run with -update to regenerate.
+func TestClauseGolden(t *testing.T) {
+	joins := []func(s *selectSQL){
+		nil,
+		func(s *selectSQL) { s.LeftJoin("tblB", "tblA.id = tblB.aid") },
+		func(s *selectSQL) {
+			s.InnerJoinUsing("tblC", "id", "cid").CrossJoin("tblD").StraightJoin("tblE", "tblE.id = tblA.eid")
+		},
+	}
+	wheres := []func(s *selectSQL){
+		nil,
+		func(s *selectSQL) { s.EQ("tblA.id", 1) },
+		func(s *selectSQL) { s.EQ("tblA.id", 1).WhereCond(Or(IsNull("tblB.aid"), GT("tblB.n", 2))) },
+	}
+	groups := []func(s *selectSQL){
+		nil,
+		func(s *selectSQL) { s.GroupBy("tblA.type") },
+	}
+	orders := []func(s *selectSQL){
+		nil,
+		func(s *selectSQL) { s.OrderBy("tblA.id DESC") },
+	}
+	limits := []func(s *selectSQL){
+		nil,
+		func(s *selectSQL) { s.Limit(10) },
+		func(s *selectSQL) { s.Offset(20).Limit(10) },
+	}
+
+	var buf bytes.Buffer
+	for i, join := range joins {
+		for j, where := range wheres {
+			for k, group := range groups {
+				for l, order := range orders {
+					for m, limit := range limits {
+						s := Select("tblA.*", "tblA")
+						for _, apply := range []func(s *selectSQL){join, where, group, order, limit} {
+							if apply != nil {
+								apply(s)
+							}
+						}
+						fmt.Fprintf(&buf, "join%d_where%d_group%d_order%d_limit%d: %s\n", i, j, k, l, m, s.GetSQL())
+					}
+				}
+			}
+		}
+	}
+	fmt.Fprintf(&buf, "hint_join_lock: %s\n", Select("tblA.*", "tblA").ForceIndex("idx_a", "idx_b").IgnoreIndex("idx_c").
+		LeftJoin("tblB", "tblA.id = tblB.aid").EQ("tblA.id", 1).OrderBy("tblA.id").Limit(1).ForUpdate().GetSQL())
+	fmt.Fprintf(&buf, "hint_share: %s\n", Select("*", "tblA").UseIndex("idx_a").EQ("id", 1).LockInShareMode().GetSQL())
+	fmt.Fprintf(&buf, "lock_nowait: %s\n", Select("*", "tblA").EQ("id", 1).ForUpdateNoWait().GetSQL())
+	fmt.Fprintf(&buf, "lock_skip_locked: %s\n", Select("*", "tblA").EQ("state", 0).Limit(5).ForUpdateSkipLocked().GetSQL())
+	fmt.Fprintf(&buf, "update_where: %s\n", Update("tblA").Set("n", 1).EQ("id", 2).GetSQL())
+	fmt.Fprintf(&buf, "update_join: %s\n", Update("tblA a").InnerJoin("tblB b", "a.id = b.aid").Set("a.n", 1).Incr("a.views", 1).
+		SetExpr("a.updated_at", "NOW()").EQ("b.x", 2).GetSQL())
+	fmt.Fprintf(&buf, "update_order_limit: %s\n", Update("tblA").Decr("stock", 2).GT("stock", 1).OrderBy("id").Limit(1).GetSQL())
+	fmt.Fprintf(&buf, "delete_where: %s\n", Delete("tblA").EQ("id", 1).GetSQL())
+	fmt.Fprintf(&buf, "delete_order_limit: %s\n", Delete("tblA").LT("created_at", "2020-01-01").OrderBy("created_at").Limit(1000).GetSQL())
+	fmt.Fprintf(&buf, "delete_join: %s\n", Delete("tblA a").LeftJoin("tblB b", "a.id = b.aid").IsNull("b.aid").GetSQL())
+	fmt.Fprintf(&buf, "delete_join_target: %s\n", Delete("tblA").InnerJoin("tblB", "tblA.id = tblB.aid").Target("tblA", "tblB").EQ("tblA.x", 1).GetSQL())
+
+	golden := filepath.Join("testdata", "clauses.golden")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("rendered SQL differs from %s, rerun with -update and review the diff:\n%s", golden, buf.String())
+	}
+}
+
+func TestSubquery(t *testing.T) {
+	paid := Select("user_id", "orders").EQ("status", "paid").GT("amount", 100)
+	query, args := Select("u.id,COUNT(*) AS n", "").
+		FromSubquery(Select("*", "users").EQ("deleted", 0), "u").
+		Distinct().
+		InSubquery("u.id", paid).
+		Exists(Select("1", "logins l").Where("l.uid = u.id").GE("l.day", "2024-01-01")).
+		GroupBy("u.id").
+		Having(GT("COUNT(*)", 2)).
+		GetParamSQL()
+
+	want := "SELECT DISTINCT u.id,COUNT(*) AS n FROM (SELECT * FROM users WHERE deleted = ?) AS u" +
+		" WHERE u.id IN (SELECT user_id FROM orders WHERE status = ? AND amount > ?)" +
+		" AND EXISTS (SELECT 1 FROM logins l WHERE (l.uid = u.id) AND l.day >= ?)" +
+		" GROUP BY u.id HAVING COUNT(*) > ?"
+	if query != want {
+		t.Fatalf("unexpected sql: %s", query)
+	}
+	if fmt.Sprint(args) != "[0 paid 100 2024-01-01 2]" {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	union := UnionAll(
+		Select("id,amount", "orders_2024").EQ("uid", 1),
+		Select("id,amount", "orders_2025").EQ("uid", 1),
+	).OrderBy("id DESC").Limit(10)
+
+	query, args := union.GetParamSQL()
+	want := "(SELECT id,amount FROM orders_2024 WHERE uid = ?) UNION ALL (SELECT id,amount FROM orders_2025 WHERE uid = ?) ORDER BY id DESC LIMIT 10"
+	if query != want || len(args) != 2 {
+		t.Fatalf("unexpected sql: %s %v", query, args)
+	}
+
+	sql := CountFrom(Union(Select("uid", "a"), Select("uid", "b"))).GetSQL()
+	if sql != "SELECT COUNT(*) FROM ((SELECT uid FROM a) UNION (SELECT uid FROM b)) AS t" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	if _, err := Union(Select("uid", "a")).EQ("uid", 1).BuildSQL(); err == nil || !strings.HasPrefix(err.Error(), "querystring[UNION] ") {
+		t.Fatalf("expected error for WHERE on a union, got %v", err)
+	}
+	_, err := Delete("tblA a").LeftJoin("tblB b", "a.id = b.aid").IsNull("b.aid").Limit(10).BuildSQL()
+	if err == nil || err.Error() != "querystring[DELETE] a multi-table DELETE can't take ORDER BY or LIMIT" {
+		t.Fatalf("expected error for LIMIT on a multi-table DELETE, got %v", err)
+	}
+}
+
+func TestFullTableGuard(t *testing.T) {
+	if _, err := Delete("tbl").BuildSQL(); err != ErrFullTable {
+		t.Fatalf("expected ErrFullTable, got %v", err)
+	}
+	if _, _, err := Update("tbl").Set("a", 1).BuildParamSQL(); err != ErrFullTable {
+		t.Fatalf("expected ErrFullTable, got %v", err)
+	}
+	if _, _, err := Update("tbl").Set("a", 1).Exec(context.Background(), nil); err != ErrFullTable {
+		t.Fatalf("expected ErrFullTable, got %v", err)
+	}
+
+	alwaysTrue := []*excuteSQL{
+		Delete("tbl").NotIn("id", []int{}),
+		Delete("tbl").WhereCond(And()),
+		Delete("tbl").WhereCond(Or(EQ("a", 1), NotIn("id", []int{}))),
+		Update("tbl").Set("a", 1).Where(""),
+		Update("tbl").Set("a", 1).Where(" 1 = 1 ").WhereCond(And(Raw(""))),
+		Delete("tbl").WhereCond(Not(Or())),
+		Delete("tbl").WhereCond(Not(IN("id", []int{}))),
+		Delete("tbl").WhereCond(Not(Raw("1 = 0"))),
+		Delete("tbl").WhereCond(Not(And(EQ("a", 1), Raw("FALSE")))),
+		Delete("tbl").WhereCond(Not(Not(And()))),
+	}
+	for _, v := range alwaysTrue {
+		if query, err := v.BuildSQL(); err != ErrFullTable {
+			t.Errorf("expected ErrFullTable for %s, got %v", query, err)
+		}
+	}
+
+	sql := Update("tbl").Set("a", 1).AllowFullTable().GetSQL()
+	if sql != "UPDATE tbl SET a = 1" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+	sql = Update("tbl").Set("a", 1).Where("").AllowFullTable().GetSQL()
+	if sql != "UPDATE tbl SET a = 1 WHERE 1 = 1" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+	if _, err := Update("tbl").EQ("a", 1).BuildSQL(); err == nil || !strings.HasPrefix(err.Error(), "querystring[UPDATE] ") {
+		t.Fatalf("expected error for an UPDATE without Set, got %v", err)
+	}
+	sql = Delete("tbl").NotIn("id", []int{}).EQ("b", 2).GetSQL()
+	if sql != "DELETE FROM tbl WHERE 1 = 1 AND b = 2" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+	sql = Delete("tbl").WhereCond(Not(Or(EQ("a", 1), IN("id", []int{})))).GetSQL()
+	if sql != "DELETE FROM tbl WHERE NOT (a = 1 OR 1 = 0)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+}
+
+func TestMaxAffected(t *testing.T) {
+	fake := &fakeDriver{affected: 5}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	ctx := context.Background()
+
+	_, _, err := Update("tbl").Set("a", 1).EQ("b", 2).MaxAffected(3).Exec(ctx, db)
+	if history := fake.history(); !errors.Is(err, ErrMaxAffected) || history != "BEGIN; UPDATE tbl SET a = ? WHERE b = ?; ROLLBACK" {
+		t.Fatalf("unexpected result: %v %s", err, history)
+	}
+
+	affected, _, err := Delete("tbl").EQ("b", 2).MaxAffected(5).Exec(ctx, db)
+	if history := fake.history(); err != nil || affected != 5 || history != "BEGIN; DELETE FROM tbl WHERE b = ?; COMMIT" {
+		t.Fatalf("unexpected result: %v %d %s", err, affected, history)
+	}
+
+	// inside a transaction the statement is undone through a savepoint
+	err = WithTx(ctx, db, nil, func(tx Executor) error {
+		_, _, err := Delete("tbl").EQ("b", 2).MaxAffected(1).Exec(ctx, tx)
+		return err
+	})
+	want := "BEGIN; SAVEPOINT qs_sp_N; DELETE FROM tbl WHERE b = ?; ROLLBACK TO SAVEPOINT qs_sp_N; ROLLBACK"
+	if history := fake.history(); !errors.Is(err, ErrMaxAffected) || history != want {
+		t.Fatalf("unexpected result: %v %s", err, history)
+	}
+}
+
+type pageRow struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func TestSelectAs(t *testing.T) {
+	query, args := SelectAs[pageRow]("tbl").EQ("id", 1).OrderBy("created_at").GetParamSQL()
+	if query != "SELECT id,created_at FROM tbl WHERE id = ? ORDER BY created_at" || len(args) != 1 {
+		t.Fatalf("unexpected sql: %s %v", query, args)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	query, args := Select("*", "tbl").EQ("uid", 1).Paginate([]string{"created_at DESC", "id DESC"}, "", 20).GetParamSQL()
+	if query != "SELECT * FROM tbl WHERE uid = ? ORDER BY created_at DESC,id DESC LIMIT 20" || len(args) != 1 {
+		t.Fatalf("unexpected sql: %s %v", query, args)
+	}
+
+	cursor, err := encodeCursor([]interface{}{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), int64(9007199254740993)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, args = Select("*", "tbl").EQ("uid", 1).Paginate([]string{"created_at DESC", "id DESC"}, cursor, 20).GetParamSQL()
+	if query != "SELECT * FROM tbl WHERE uid = ? AND (created_at, id) < (?, ?) ORDER BY created_at DESC,id DESC LIMIT 20" {
+		t.Fatalf("unexpected sql: %s", query)
+	}
+	if args[1] != "2024-01-02 03:04:05" || args[2] != int64(9007199254740993) {
+		t.Fatalf("unexpected args: %#v", args)
+	}
+
+	if _, err := Select("*", "tbl").Paginate([]string{"id"}, "not a cursor", 20).BuildSQL(); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	sql := Select("*", "tbl").LeftJoin("b", "b.id = tbl.bid").EQ("uid", 1).OrderBy("id").Limit(10).CountQuery().GetSQL()
+	if sql != "SELECT COUNT(*) FROM tbl LEFT JOIN b ON b.id = tbl.bid WHERE uid = 1" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+	sql = Select("uid", "tbl").GroupBy("uid").OrderBy("uid").Limit(10).CountQuery().GetSQL()
+	if sql != "SELECT COUNT(*) FROM (SELECT uid FROM tbl GROUP BY uid) AS t" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+}
+
+type fakeRows struct {
+	driver  *fakeDriver
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (this *fakeRows) Columns() []string {
+	return this.columns
+}
+
+func (this *fakeRows) Close() error {
+	this.driver.closed++
+	return nil
+}
+
+func (this *fakeRows) Next(dest []driver.Value) error {
+	if this.pos >= len(this.rows) {
+		return io.EOF
+	}
+	copy(dest, this.rows[this.pos])
+	this.pos++
+	return nil
+}
+
+func TestEach(t *testing.T) {
+	fake := &fakeDriver{
+		columns: []string{"id", "created_at", "extra"},
+		rows: [][]driver.Value{
+			{int64(1), []byte("2024-01-01 00:00:00"), "x"},
+			{int64(2), []byte("2024-01-02 00:00:00"), "y"},
+			{int64(3), []byte("2024-01-03 00:00:00"), "z"},
+		},
+	}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+
+	ids := make([]int64, 0)
+	err := Select("*", "tbl").Each(context.Background(), db, func(row *pageRow) error {
+		ids = append(ids, row.ID)
+		if len(ids) == 2 {
+			return ErrStop
+		}
+		return nil
+	})
+	if err != nil || fmt.Sprint(ids) != "[1 2]" || fake.closed != 1 {
+		t.Fatalf("unexpected result: %v %v closed=%d", err, ids, fake.closed)
+	}
+
+	var rows []pageRow
+	count, err := Select("*", "tbl").QueryAll(context.Background(), db, &rows)
+	if err != nil || count != 3 || rows[2].CreatedAt.Day() != 3 || fake.closed != 2 {
+		t.Fatalf("unexpected result: %v %+v closed=%d", err, rows, fake.closed)
+	}
+
+	typed, err := SelectAs[pageRow]("tbl").GT("id", 0).All(context.Background(), db)
+	if err != nil || len(typed) != 3 || typed[0].ID != 1 {
+		t.Fatalf("unexpected result: %v %+v", err, typed)
+	}
+	first, ok, err := SelectAs[pageRow]("tbl").One(context.Background(), db)
+	if err != nil || !ok || first.ID != 1 {
+		t.Fatalf("unexpected result: %v %v %+v", err, ok, first)
+	}
+
+	if err := Select("*", "tbl").Each(context.Background(), db, func(row pageRow) {}); err == nil {
+		t.Fatal("expected error for a func without an error result")
+	}
+}
+
+type PageBase struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type pageItem struct {
+	*PageBase
+	Extra string `db:"extra"`
+}
+
+func TestQueryPage(t *testing.T) {
+	fake := &fakeDriver{
+		columns: []string{"id", "created_at", "extra"},
+		rows: [][]driver.Value{
+			{int64(3), []byte("2024-01-03 00:00:00"), "z"},
+			{int64(2), []byte("2024-01-02 00:00:00"), "y"},
+		},
+	}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	ctx := context.Background()
+	fields := []string{"t.created_at DESC", "t.id DESC"}
+
+	var items []*pageItem
+	cursor, err := Select("t.*", "tbl t").Paginate(fields, "", 2).QueryPage(ctx, db, &items)
+	if err != nil || len(items) != 2 || items[1].ID != 2 {
+		t.Fatalf("unexpected page: %v %+v", err, items)
+	}
+	if history := fake.history(); history != "SELECT t.* FROM tbl t ORDER BY t.created_at DESC,t.id DESC LIMIT 2" {
+		t.Fatalf("unexpected query: %s", history)
+	}
+	values, err := decodeCursor(cursor)
+	if err != nil || fmt.Sprint(values) != "[2024-01-02 00:00:00 2]" {
+		t.Fatalf("unexpected cursor: %v %v", err, values)
+	}
+
+	// the cursor of the last row starts the next page, a short page ends it
+	var rows []pageRow
+	next, err := Select("t.*", "tbl t").Paginate(fields, cursor, 3).QueryPage(ctx, db, &rows)
+	if err != nil || next != "" || len(rows) != 2 {
+		t.Fatalf("expected the last page: %v %q %+v", err, next, rows)
+	}
+	want := "SELECT t.* FROM tbl t WHERE (t.created_at, t.id) < (?, ?) ORDER BY t.created_at DESC,t.id DESC LIMIT 3"
+	if history := fake.history(); history != want {
+		t.Fatalf("unexpected query: %s", history)
+	}
+
+	if _, err := Select("*", "tbl").Paginate([]string{"missing"}, "", 2).QueryPage(ctx, db, &rows); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("expected an unknown cursor field error, got %v", err)
+	}
+	if _, err := Select("*", "tbl").Paginate([]string{"id"}, "", 0).QueryPage(ctx, db, &rows); err == nil {
+		t.Fatal("expected error for a zero page size")
+	}
+	if history := fake.history(); history != "SELECT * FROM tbl ORDER BY missing LIMIT 2" {
+		t.Fatalf("unexpected queries: %s", history)
+	}
+}
+
+func TestPage(t *testing.T) {
+	fake := &fakeDriver{
+		columns: []string{"id", "created_at"},
+		rows:    [][]driver.Value{{int64(5), []byte("2024-01-05 00:00:00")}},
+		count:   42,
+	}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	ctx := context.Background()
+
+	query := Select("*", "tbl").EQ("uid", 1).OrderBy("id")
+	var rows []pageRow
+	total, err := query.Page(ctx, db, 3, 2, &rows)
+	if err != nil || total != 42 || len(rows) != 1 || rows[0].ID != 5 {
+		t.Fatalf("unexpected page: %v %d %+v", err, total, rows)
+	}
+	want := "SELECT COUNT(*) FROM tbl WHERE uid = ?; SELECT * FROM tbl WHERE uid = ? ORDER BY id LIMIT 4, 2"
+	if history := fake.history(); history != want {
+		t.Fatalf("unexpected queries: %s", history)
+	}
+	if sql := query.GetSQL(); sql != "SELECT * FROM tbl WHERE uid = 1 ORDER BY id" {
+		t.Fatalf("Page modified the select: %s", sql)
+	}
+
+	if _, err := query.Page(ctx, db, 1, 0, &rows); err == nil || fake.history() != "" {
+		t.Fatal("expected error for a zero page size")
+	}
+}
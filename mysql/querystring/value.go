@@ -0,0 +1,134 @@
+package querystring
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const datetimeFormat = "2006-01-02 15:04:05.999999"
+
+var (
+	valuerType        = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// encodeValue renders value as a MySQL literal. It is the single place every
+// builder turns a Go value into SQL text.
+func encodeValue(value interface{}) (string, error) {
+	value, err := normalizeValue(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "NULL", nil
+	case rawValue:
+		return string(v), nil
+	case time.Time:
+		return "'" + v.Format(datetimeFormat) + "'", nil
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case string:
+		return "'" + Escape(v) + "'", nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("querystring: unsupported value type %T", value)
+}
+
+// encodeArg converts value into a placeholder argument database/sql accepts,
+// applying the same rules as encodeValue.
+func encodeArg(value interface{}) (interface{}, error) {
+	value, err := normalizeValue(value)
+	if err != nil {
+		return nil, err
+	}
+	if raw, ok := value.(rawValue); ok {
+		return string(raw), nil
+	}
+	return value, nil
+}
+
+// normalizeValue reduces value to nil, rawValue, time.Time, []byte, string,
+// bool, int64, uint64 or float64, resolving pointers, driver.Valuer and
+// json.Marshaler on the way.
+func normalizeValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, rawValue, time.Time, string, bool, int64, uint64:
+		return value, nil
+	case []byte:
+		if v == nil {
+			return nil, nil
+		}
+		return value, nil
+	}
+
+	valueof := reflect.ValueOf(value)
+	if valueof.Kind() == reflect.Ptr && valueof.IsNil() {
+		return nil, nil
+	}
+
+	if valueof.Type().Implements(valuerType) {
+		dv, err := value.(driver.Valuer).Value()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := dv.(driver.Valuer); ok {
+			return nil, fmt.Errorf("querystring: %T.Value returned another driver.Valuer", value)
+		}
+		return normalizeValue(dv)
+	}
+
+	// dereference before the json.Marshaler check, *time.Time gets MarshalJSON
+	// from time.Time and must still be written as a datetime
+	if valueof.Kind() == reflect.Ptr && (!valueof.Type().Implements(jsonMarshalerType) || valueof.Elem().Type().Implements(jsonMarshalerType)) {
+		return normalizeValue(valueof.Elem().Interface())
+	}
+
+	if valueof.Type().Implements(jsonMarshalerType) {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+
+	switch valueof.Kind() {
+	case reflect.String:
+		return valueof.String(), nil
+	case reflect.Bool:
+		return valueof.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return valueof.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return valueof.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		f := valueof.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("querystring: unsupported float value %v", f)
+		}
+		if valueof.Kind() == reflect.Float32 {
+			// keep 1.1 as 1.1 rather than 1.100000023841858
+			f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, 32), 64)
+		}
+		return f, nil
+	case reflect.Slice:
+		if valueof.Type().Elem().Kind() == reflect.Uint8 {
+			return normalizeValue(valueof.Bytes())
+		}
+	}
+	return nil, fmt.Errorf("querystring: unsupported value type %T", value)
+}
@@ -1,142 +1,337 @@
 package querystring
 
 import (
+	"errors"
 	"fmt"
-	"reflect"
-	"strconv"
 	"strings"
 )
 
+type assignment struct {
+	field string
+	op    string
+	value interface{}
+}
+
+func (this *assignment) writeTo(w *sqlWriter) {
+	if len(this.op) > 0 {
+		w.WriteString(fmt.Sprintf("%s = %s %s ", this.field, this.field, this.op))
+	} else {
+		w.WriteString(fmt.Sprintf("%s = ", this.field))
+	}
+	w.WriteValue(this.value)
+}
+
 type whereMaker struct {
-	command    string
-	table      string
-	fields     string
-	whereArray []string
-	joinArray  []string
-	group      string
-	order      string
-	start      int64
-	limit      int64
+	command     string
+	distinct    bool
+	table       string
+	fromSub     *selectSQL
+	hintArray   []string
+	fields      string
+	setArray    []*assignment
+	whereArray  []Condition
+	joinArray   []string
+	group       string
+	havingArray []Condition
+	unionArray  []*selectSQL
+	order       string
+	start       int64
+	limit       int64
+	lock        string
+	targets     []string
+	fullTable   bool
+
+	cursorFields []cursorField
 }
 
 func newWhereMaker(command string, table string, fields string) *whereMaker {
 	return &whereMaker{
-		command:    command,
-		table:      table,
-		fields:     fields,
-		whereArray: make([]string, 0),
-		joinArray:  make([]string, 0),
+		command:     command,
+		table:       table,
+		fields:      fields,
+		hintArray:   make([]string, 0),
+		setArray:    make([]*assignment, 0),
+		whereArray:  make([]Condition, 0),
+		joinArray:   make([]string, 0),
+		havingArray: make([]Condition, 0),
 	}
 }
 
-func (this *whereMaker) ToString() string {
-	sqlString := ""
+func (this *whereMaker) build(param bool) (string, []interface{}, error) {
+	w := newSQLWriter(param)
+	this.writeTo(w)
+	return w.String(), w.Args(), w.Err()
+}
+
+// writeTo renders the clauses in MySQL grammar order:
+// SELECT [DISTINCT] ... FROM table [index hints] [JOIN ...] [WHERE] [GROUP BY] [HAVING] [ORDER BY] [LIMIT] [locking]
+// UPDATE table [JOIN ...] SET ... [WHERE] [ORDER BY] [LIMIT]
+// DELETE FROM table [WHERE] [ORDER BY] [LIMIT]
+// DELETE target FROM table JOIN ... [WHERE]
+// (SELECT ...) UNION [ALL] (SELECT ...) [ORDER BY] [LIMIT]
+func (this *whereMaker) writeTo(w *sqlWriter) {
+	switch this.command {
+	case "SELECT":
+		if this.distinct {
+			w.WriteString(fmt.Sprintf("SELECT DISTINCT %s FROM ", this.fields))
+		} else {
+			w.WriteString(fmt.Sprintf("SELECT %s FROM ", this.fields))
+		}
+		if this.fromSub != nil {
+			w.WriteString("(")
+			this.fromSub.writeTo(w)
+			w.WriteString(fmt.Sprintf(") AS %s", this.table))
+		} else {
+			w.WriteString(this.table)
+		}
+		for _, v := range this.hintArray {
+			w.WriteString(" " + v)
+		}
+		this.writeJoin(w)
+	case "DELETE":
+		if len(this.joinArray) > 0 {
+			w.WriteString(fmt.Sprintf("DELETE %s FROM %s", strings.Join(this.deleteTargets(), ","), this.table))
+			this.writeJoin(w)
+		} else {
+			w.WriteString(fmt.Sprintf("DELETE FROM %s", this.table))
+		}
+	case "UPDATE":
+		w.WriteString(fmt.Sprintf("UPDATE %s", this.table))
+		this.writeJoin(w)
+		w.WriteString(" SET ")
+		if len(this.setArray) == 0 {
+			w.setErr(errors.New("querystring[UPDATE] needs at least one Set"))
+		}
+		for i, v := range this.setArray {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			v.writeTo(w)
+		}
+	case "UNION", "UNION ALL":
+		for i, v := range this.unionArray {
+			if i > 0 {
+				w.WriteString(" " + this.command + " ")
+			}
+			w.WriteString("(")
+			v.writeTo(w)
+			w.WriteString(")")
+		}
+		if len(this.whereArray) > 0 || len(this.joinArray) > 0 || len(this.group) > 0 || len(this.havingArray) > 0 {
+			w.setErr(errors.New("querystring[UNION] only takes ORDER BY and LIMIT, filter it through FromSubquery"))
+		}
+	}
 
-	if this.command == "SELECT" {
-		sqlString = fmt.Sprintf("%s %s FROM %s", this.command, this.fields, this.table)
-	} else if this.command == "DELETE" {
-		sqlString = fmt.Sprintf("%s FROM %s", this.command, this.table)
-	} else if this.command == "UPDATE" {
-		sqlString = fmt.Sprintf("%s %s SET %s", this.command, this.table, this.fields)
+	if (this.command == "UPDATE" || this.command == "DELETE") && allTrue(this.whereArray) && !this.fullTable {
+		w.setErr(ErrFullTable)
 	}
 
 	if len(this.whereArray) > 0 {
-		sqlString += fmt.Sprintf(" WHERE %s", strings.Join(this.whereArray, " AND "))
+		w.WriteString(" WHERE ")
+		writeConditionList(w, this.whereArray)
 	}
 
-	if len(this.joinArray) > 0 {
-		sqlString += " "
-		sqlString += strings.Join(this.joinArray, " ")
+	if len(this.group) > 0 {
+		w.WriteString(fmt.Sprintf(" GROUP BY %s", this.group))
 	}
 
-	if len(this.group) > 0 {
-		sqlString += fmt.Sprintf(" GROUP BY %s", this.group)
+	if len(this.havingArray) > 0 {
+		w.WriteString(" HAVING ")
+		writeConditionList(w, this.havingArray)
+	}
+
+	if (this.command == "UPDATE" || this.command == "DELETE") && len(this.joinArray) > 0 &&
+		(len(this.order) > 0 || this.limit > 0) {
+		w.setErr(fmt.Errorf("querystring[%s] a multi-table %s can't take ORDER BY or LIMIT", this.command, this.command))
 	}
 
 	if len(this.order) > 0 {
-		sqlString += fmt.Sprintf(" ORDER BY %s", this.order)
+		w.WriteString(fmt.Sprintf(" ORDER BY %s", this.order))
 	}
 
 	if this.limit > 0 {
 		if this.start > 0 {
-			sqlString += fmt.Sprintf(" LIMIT %d, %d", this.start, this.limit)
+			w.WriteString(fmt.Sprintf(" LIMIT %d, %d", this.start, this.limit))
 		} else {
-			sqlString += fmt.Sprintf(" LIMIT %d", this.limit)
+			w.WriteString(fmt.Sprintf(" LIMIT %d", this.limit))
 		}
 	}
 
-	return sqlString
+	if len(this.lock) > 0 {
+		w.WriteString(" " + this.lock)
+	}
+}
+
+// deleteTargets defaults to the alias of the main table, "orders o" deletes
+// from o.
+func (this *whereMaker) deleteTargets() []string {
+	if len(this.targets) > 0 {
+		return this.targets
+	}
+	words := strings.Fields(this.table)
+	if len(words) == 0 {
+		return words
+	}
+	return words[len(words)-1:]
+}
+
+func (this *whereMaker) writeJoin(w *sqlWriter) {
+	if len(this.joinArray) > 0 {
+		w.WriteString(" ")
+		w.WriteString(strings.Join(this.joinArray, " "))
+	}
+}
+
+func writeConditionList(w *sqlWriter, conds []Condition) {
+	if len(conds) == 1 {
+		conds[0].writeTo(w)
+		return
+	}
+	for i, v := range conds {
+		if i > 0 {
+			w.WriteString(" AND ")
+		}
+		writeCondition(w, v)
+	}
 }
 
 func (this *whereMaker) Where(where string) *whereMaker {
-	this.whereArray = append(this.whereArray, where)
+	this.whereArray = append(this.whereArray, rawWhere(where))
 	return this
 }
 
-func (this *whereMaker) appendWhereString(field string, cmp string, value interface{}) {
-	valueof := reflect.ValueOf(value)
-	switch valueof.Type().Kind() {
-	case reflect.String:
-		this.whereArray = append(this.whereArray, fmt.Sprintf("%s = '%s'", field, valueof.String()))
-	case reflect.Bool:
-		this.whereArray = append(this.whereArray, fmt.Sprintf("%s = %t", field, valueof.Bool()))
-	case reflect.Int, reflect.Int32, reflect.Int64:
-		this.whereArray = append(this.whereArray, fmt.Sprintf("%s = %d", field, valueof.Int()))
-	case reflect.Uint, reflect.Uint32, reflect.Uint64:
-		this.whereArray = append(this.whereArray, fmt.Sprintf("%s = %d", field, valueof.Uint()))
-	case reflect.Float32, reflect.Float64:
-		this.whereArray = append(this.whereArray, fmt.Sprintf("%s = %f", field, valueof.Float()))
-	}
+func (this *whereMaker) Set(field string, value interface{}) *whereMaker {
+	this.setArray = append(this.setArray, &assignment{field: field, value: value})
+	return this
 }
 
-func (this *whereMaker) EQ(field string, value interface{}) *whereMaker {
-	this.appendWhereString(field, "=", value)
+func (this *whereMaker) SetWithOp(field string, op string, value interface{}) *whereMaker {
+	this.setArray = append(this.setArray, &assignment{field: field, op: op, value: value})
 	return this
 }
 
-func (this *whereMaker) GT(field string, value interface{}) *whereMaker {
-	this.appendWhereString(field, ">", value)
+func (this *whereMaker) WhereCond(conds ...Condition) *whereMaker {
+	this.whereArray = append(this.whereArray, conds...)
 	return this
 }
 
-func (this *whereMaker) GE(field string, value interface{}) *whereMaker {
-	this.appendWhereString(field, ">=", value)
+func (this *whereMaker) Having(conds ...Condition) *whereMaker {
+	this.havingArray = append(this.havingArray, conds...)
 	return this
 }
 
+func (this *whereMaker) EQ(field string, value interface{}) *whereMaker {
+	return this.WhereCond(EQ(field, value))
+}
+
+func (this *whereMaker) NE(field string, value interface{}) *whereMaker {
+	return this.WhereCond(NE(field, value))
+}
+
+func (this *whereMaker) GT(field string, value interface{}) *whereMaker {
+	return this.WhereCond(GT(field, value))
+}
+
+func (this *whereMaker) GE(field string, value interface{}) *whereMaker {
+	return this.WhereCond(GE(field, value))
+}
+
 func (this *whereMaker) LT(field string, value interface{}) *whereMaker {
-	this.appendWhereString(field, "<", value)
-	return this
+	return this.WhereCond(LT(field, value))
 }
 
 func (this *whereMaker) LE(field string, value interface{}) *whereMaker {
-	this.appendWhereString(field, "<=", value)
-	return this
+	return this.WhereCond(LE(field, value))
+}
+
+func (this *whereMaker) Like(field string, pattern string) *whereMaker {
+	return this.WhereCond(Like(field, pattern))
+}
+
+func (this *whereMaker) NotLike(field string, pattern string) *whereMaker {
+	return this.WhereCond(NotLike(field, pattern))
+}
+
+func (this *whereMaker) IsNull(field string) *whereMaker {
+	return this.WhereCond(IsNull(field))
+}
+
+func (this *whereMaker) IsNotNull(field string) *whereMaker {
+	return this.WhereCond(IsNotNull(field))
+}
+
+func (this *whereMaker) IN(field string, values interface{}) *whereMaker {
+	return this.WhereCond(IN(field, values))
+}
+
+func (this *whereMaker) NotIn(field string, values interface{}) *whereMaker {
+	return this.WhereCond(NotIn(field, values))
+}
+
+func (this *whereMaker) Between(field string, min interface{}, max interface{}) *whereMaker {
+	return this.WhereCond(Between(field, min, max))
+}
+
+func (this *whereMaker) InSubquery(field string, sub *selectSQL) *whereMaker {
+	return this.WhereCond(InSubquery(field, sub))
+}
+
+func (this *whereMaker) NotInSubquery(field string, sub *selectSQL) *whereMaker {
+	return this.WhereCond(NotInSubquery(field, sub))
+}
+
+func (this *whereMaker) Exists(sub *selectSQL) *whereMaker {
+	return this.WhereCond(Exists(sub))
+}
+
+func (this *whereMaker) NotExists(sub *selectSQL) *whereMaker {
+	return this.WhereCond(NotExists(sub))
 }
 
-func (this *whereMaker) IN(field string, intArray []int64) *whereMaker {
-	stringArray := make([]string, len(intArray))
-	for i, v := range intArray {
-		stringArray[i] = strconv.FormatInt(v, 64)
+func (this *whereMaker) join(kind string, table string, on string) *whereMaker {
+	if len(on) > 0 {
+		this.joinArray = append(this.joinArray, fmt.Sprintf("%s %s ON %s", kind, table, on))
+	} else {
+		this.joinArray = append(this.joinArray, fmt.Sprintf("%s %s", kind, table))
 	}
-	this.appendWhereString(field, "IN", fmt.Sprintf("(%s)", strings.Join(stringArray, ",")))
 	return this
 }
 
-func (this *whereMaker) Between(field string, min int, max int) *whereMaker {
-	this.appendWhereString(field, ">=", min)
-	this.appendWhereString(field, "<", max)
+func (this *whereMaker) joinUsing(kind string, table string, columns []string) *whereMaker {
+	this.joinArray = append(this.joinArray, fmt.Sprintf("%s %s USING (%s)", kind, table, strings.Join(columns, ",")))
 	return this
 }
 
+func (this *whereMaker) InnerJoin(table string, on string) *whereMaker {
+	return this.join("INNER JOIN", table, on)
+}
+
 func (this *whereMaker) LeftJoin(table string, on string) *whereMaker {
-	this.joinArray = append(this.joinArray, fmt.Sprintf("LEFT JOIN %s ON %s", table, on))
-	return this
+	return this.join("LEFT JOIN", table, on)
 }
 
 func (this *whereMaker) RightJoin(table string, on string) *whereMaker {
-	this.joinArray = append(this.joinArray, fmt.Sprintf("RIGHT JOIN %s ON %s", table, on))
-	return this
+	return this.join("RIGHT JOIN", table, on)
+}
+
+func (this *whereMaker) CrossJoin(table string) *whereMaker {
+	return this.join("CROSS JOIN", table, "")
+}
+
+func (this *whereMaker) StraightJoin(table string, on string) *whereMaker {
+	return this.join("STRAIGHT_JOIN", table, on)
+}
+
+func (this *whereMaker) InnerJoinUsing(table string, columns ...string) *whereMaker {
+	return this.joinUsing("INNER JOIN", table, columns)
+}
+
+func (this *whereMaker) LeftJoinUsing(table string, columns ...string) *whereMaker {
+	return this.joinUsing("LEFT JOIN", table, columns)
+}
+
+func (this *whereMaker) RightJoinUsing(table string, columns ...string) *whereMaker {
+	return this.joinUsing("RIGHT JOIN", table, columns)
 }
 
 func (this *whereMaker) GroupBy(group string) *whereMaker {